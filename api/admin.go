@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gocql/gocql"
+	"github.com/gorilla/mux"
+
+	"github.com/Altoros/cf-cassandra-broker/config"
+)
+
+// AdminHandler serves administrative endpoints of the broker
+type AdminHandler struct {
+	Handler   *negroni.Negroni
+	Rotator   CredentialRotator
+	Inventory InstanceInventory
+}
+
+func NewAdmin(appConfig *config.Config, session *gocql.Session, dialect Dialect, drain *Drain) http.Handler {
+	adminHandler := new(AdminHandler)
+	adminHandler.Handler = negroni.New(NewLogger(), NewRecovery(), drain)
+	adminHandler.Rotator = NewCredentialRotator(appConfig, session, dialect)
+	adminHandler.Inventory = NewInstanceInventory(appConfig, session)
+
+	adminHandler.DefineRoutes()
+
+	return adminHandler
+}
+
+func (a *AdminHandler) DefineRoutes() {
+	router := mux.NewRouter()
+
+	router.HandleFunc("/admin/service_instances", a.ListInstances).Methods("GET")
+	router.HandleFunc("/admin/service_instances/{instance_id}", a.GetInstance).Methods("GET")
+	router.HandleFunc("/admin/rotate_credentials", a.RotateAllCredentials).Methods("POST")
+	router.HandleFunc("/admin/service_instances/{instance_id}/rotate_credentials", a.RotateInstanceCredentials).Methods("POST")
+	router.HandleFunc("/admin/service_bindings/{binding_id}/rotate_credentials", a.RotateBindingCredentials).Methods("POST")
+
+	a.Handler.UseHandler(router)
+}
+
+func (a *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.Handler.ServeHTTP(w, r)
+}
+
+func (a *AdminHandler) ListInstances(w http.ResponseWriter, r *http.Request) {
+	instances, serviceError := a.Inventory.ListInstances()
+	if serviceError != nil {
+		writeError(w, serviceError)
+		return
+	}
+
+	renderer.JSON(w, http.StatusOK, map[string][]InstanceRecord{"instances": instances})
+}
+
+func (a *AdminHandler) GetInstance(w http.ResponseWriter, r *http.Request) {
+	instance, serviceError := a.Inventory.GetInstanceRecord(mux.Vars(r)["instance_id"])
+	if serviceError != nil {
+		writeError(w, serviceError)
+		return
+	}
+
+	renderer.JSON(w, http.StatusOK, instance)
+}
+
+func (a *AdminHandler) RotateAllCredentials(w http.ResponseWriter, r *http.Request) {
+	a.rotateCredentials(w, r, RotationScope{})
+}
+
+func (a *AdminHandler) RotateInstanceCredentials(w http.ResponseWriter, r *http.Request) {
+	a.rotateCredentials(w, r, RotationScope{InstanceID: mux.Vars(r)["instance_id"]})
+}
+
+func (a *AdminHandler) RotateBindingCredentials(w http.ResponseWriter, r *http.Request) {
+	a.rotateCredentials(w, r, RotationScope{BindingID: mux.Vars(r)["binding_id"]})
+}
+
+func (a *AdminHandler) rotateCredentials(w http.ResponseWriter, r *http.Request, scope RotationScope) {
+	actor, _, _ := r.BasicAuth()
+	if actor == "" {
+		actor = "admin"
+	}
+
+	rotationResponse, serviceError := a.Rotator.RotateCredentials(scope, actor)
+	if serviceError != nil {
+		writeError(w, serviceError)
+		return
+	}
+
+	renderer.JSON(w, http.StatusOK, rotationResponse)
+}
@@ -0,0 +1,169 @@
+package api_test
+
+import (
+	"github.com/Altoros/cf-cassandra-broker/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-community/types-cf"
+	"github.com/codegangsta/negroni"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+type mockInstanceInventory struct{}
+
+var inventoryCreatedAt = time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func (mockInstanceInventory) ListInstances() ([]api.InstanceRecord, *cf.ServiceProviderError) {
+	return []api.InstanceRecord{
+		{InstanceID: "instance-id", Keyspace: "cfkeyspace", ServiceID: "service-id", PlanID: "plan-id",
+			OrganizationGUID: "org-guid", SpaceGUID: "space-guid", State: "ready", CreatedAt: inventoryCreatedAt},
+	}, nil
+}
+
+func (mockInstanceInventory) GetInstanceRecord(instanceID string) (*api.InstanceRecord, *cf.ServiceProviderError) {
+	if instanceID != "instance-id" {
+		return nil, cf.NewServiceProviderError(api.ErrorNotFound, errors.New(instanceID))
+	}
+
+	return &api.InstanceRecord{
+		InstanceID: "instance-id", Keyspace: "cfkeyspace", ServiceID: "service-id", PlanID: "plan-id",
+		OrganizationGUID: "org-guid", SpaceGUID: "space-guid", Platform: "cloudfoundry",
+		Context: map[string]interface{}{"platform": "cloudfoundry"}, State: "ready", CreatedAt: inventoryCreatedAt,
+		Bindings: []api.BindingRecord{
+			{BindingID: "binding-id", AppGUID: "app-guid", Username: "cf-user", PermissionProfile: "full",
+				State: "ready", CreatedAt: inventoryCreatedAt},
+		},
+	}, nil
+}
+
+type mockCredentialRotator struct {
+	Scope api.RotationScope
+	Actor string
+}
+
+func (r *mockCredentialRotator) RotateCredentials(scope api.RotationScope, actor string) (*api.RotationResponse, *cf.ServiceProviderError) {
+	r.Scope = scope
+	r.Actor = actor
+
+	if scope.BindingID == "unknown" {
+		return nil, cf.NewServiceProviderError(api.ErrorNotFound, errors.New(scope.BindingID))
+	}
+
+	return &api.RotationResponse{
+		Bindings: []api.RotatedBinding{
+			{BindingID: "binding-id", InstanceID: "instance-id", AppGUID: "app-guid"},
+		},
+		RestageApps: []string{"app-guid"},
+	}, nil
+}
+
+var _ = Describe("Admin", func() {
+	var adminInstance api.AdminHandler
+	var rotator *mockCredentialRotator
+	var recorder *httptest.ResponseRecorder
+
+	rotate := func(path string) {
+		request, _ := http.NewRequest("POST", path, nil)
+		request.SetBasicAuth("operator", "secret")
+		adminInstance.ServeHTTP(recorder, request)
+	}
+
+	BeforeEach(func() {
+		rotator = &mockCredentialRotator{}
+		adminInstance = api.AdminHandler{
+			Handler:   negroni.New(),
+			Rotator:   rotator,
+			Inventory: mockInstanceInventory{},
+		}
+		adminInstance.DefineRoutes()
+		recorder = httptest.NewRecorder()
+	})
+
+	Describe("POST /admin/rotate_credentials", func() {
+		BeforeEach(func() {
+			rotate("/admin/rotate_credentials")
+		})
+
+		It("returns a status code of 200", func() {
+			Ω(recorder.Code).To(Equal(200))
+		})
+
+		It("rotates every binding", func() {
+			Ω(rotator.Scope).To(Equal(api.RotationScope{}))
+		})
+
+		It("records the actor", func() {
+			Ω(rotator.Actor).To(Equal("operator"))
+		})
+
+		It("returns json with applications to restage", func() {
+			Ω(recorder.Body).To(MatchJSON(`{
+				"bindings": [{"binding_id": "binding-id", "instance_id": "instance-id", "app_guid": "app-guid"}],
+				"restage_apps": ["app-guid"]
+			}`))
+		})
+	})
+
+	Describe("POST /admin/service_instances/:instance_id/rotate_credentials", func() {
+		It("rotates bindings of the instance", func() {
+			rotate("/admin/service_instances/instance-id/rotate_credentials")
+			Ω(rotator.Scope).To(Equal(api.RotationScope{InstanceID: "instance-id"}))
+		})
+	})
+
+	Describe("POST /admin/service_bindings/:binding_id/rotate_credentials", func() {
+		It("rotates the binding", func() {
+			rotate("/admin/service_bindings/binding-id/rotate_credentials")
+			Ω(rotator.Scope).To(Equal(api.RotationScope{BindingID: "binding-id"}))
+		})
+
+		It("returns a status code of 404 for unknown binding", func() {
+			rotate("/admin/service_bindings/unknown/rotate_credentials")
+			Ω(recorder.Code).To(Equal(404))
+		})
+	})
+
+	Describe("GET /admin/service_instances", func() {
+		It("returns owners of the instances", func() {
+			request, _ := http.NewRequest("GET", "/admin/service_instances", nil)
+			adminInstance.ServeHTTP(recorder, request)
+
+			Ω(recorder.Code).To(Equal(200))
+			Ω(recorder.Body).To(MatchJSON(`{"instances": [{
+				"instance_id": "instance-id", "keyspace": "cfkeyspace", "service_id": "service-id",
+				"plan_id": "plan-id", "organization_guid": "org-guid", "space_guid": "space-guid",
+				"state": "ready", "created_at": "2017-03-01T12:00:00Z"
+			}]}`))
+		})
+	})
+
+	Describe("GET /admin/service_instances/:instance_id", func() {
+		It("returns the instance with its bindings", func() {
+			request, _ := http.NewRequest("GET", "/admin/service_instances/instance-id", nil)
+			adminInstance.ServeHTTP(recorder, request)
+
+			Ω(recorder.Code).To(Equal(200))
+			Ω(recorder.Body).To(MatchJSON(`{
+				"instance_id": "instance-id", "keyspace": "cfkeyspace", "service_id": "service-id",
+				"plan_id": "plan-id", "organization_guid": "org-guid", "space_guid": "space-guid",
+				"platform": "cloudfoundry", "context": {"platform": "cloudfoundry"},
+				"state": "ready", "created_at": "2017-03-01T12:00:00Z",
+				"bindings": [{"binding_id": "binding-id", "app_guid": "app-guid", "username": "cf-user",
+					"permission_profile": "full", "state": "ready", "created_at": "2017-03-01T12:00:00Z"}]
+			}`))
+		})
+
+		It("returns a status code of 404 for unknown instance", func() {
+			request, _ := http.NewRequest("GET", "/admin/service_instances/unknown", nil)
+			adminInstance.ServeHTTP(recorder, request)
+
+			Ω(recorder.Code).To(Equal(404))
+		})
+	})
+})
@@ -2,8 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/cloudfoundry-community/types-cf"
 	"github.com/codegangsta/negroni"
@@ -12,6 +15,7 @@ import (
 	"github.com/unrolled/render"
 
 	"github.com/Altoros/cf-cassandra-broker/config"
+	"github.com/Altoros/cf-cassandra-broker/schema"
 )
 
 var (
@@ -20,21 +24,26 @@ var (
 )
 
 type ApiHandler struct {
-	Handler *negroni.Negroni
-	Config  *config.Config
-	Service ServiceProvider
+	Handler    *negroni.Negroni
+	Config     *config.Config
+	Service    ServiceProvider
+	Operations OperationStore
+	Logger     *Logger
+
+	// Drain tracks asynchronous operations, they are not tracked if it is not set
+	Drain *Drain
 }
 
-func New(appConfig *config.Config, session *gocql.Session) http.Handler {
+func New(appConfig *config.Config, session *gocql.Session, dialect Dialect, drain *Drain) http.Handler {
 	apiHandler := new(ApiHandler)
 	apiHandler.Config = appConfig
 
 	apiLogger := NewLogger()
-	panicRecovery := negroni.NewRecovery()
-	panicRecovery.PrintStack = false
-	panicRecovery.Logger = apiLogger.Logger
-	apiHandler.Handler = negroni.New(apiLogger, panicRecovery)
-	apiHandler.Service = &cassandraService{session: session}
+	apiHandler.Handler = negroni.New(apiLogger, NewRecovery(), drain, NewVersionNegotiator())
+	apiHandler.Service = newCassandraService(appConfig, session, dialect)
+	apiHandler.Operations = &cassandraOperationStore{session: session, consistency: appConfig.Cassandra.Consistency}
+	apiHandler.Logger = apiLogger
+	apiHandler.Drain = drain
 
 	apiHandler.DefineRoutes()
 
@@ -46,7 +55,11 @@ func (a *ApiHandler) DefineRoutes() {
 
 	router.HandleFunc("/v2/catalog", a.ShowCatalog).Methods("GET")
 	router.HandleFunc("/v2/service_instances/{instance_id}", a.CreateServiceInstance).Methods("PUT")
+	router.HandleFunc("/v2/service_instances/{instance_id}", a.GetServiceInstance).Methods("GET")
+	router.HandleFunc("/v2/service_instances/{instance_id}", a.UpdateServiceInstance).Methods("PATCH")
 	router.HandleFunc("/v2/service_instances/{instance_id}", a.DeleteServiceInstance).Methods("DELETE")
+	router.HandleFunc("/v2/service_instances/{instance_id}/last_operation", a.LastOperation).Methods("GET")
+	router.HandleFunc("/v2/service_instances/{instance_id}/service_bindings/{binding_id}", a.GetServiceBinding).Methods("GET")
 	router.HandleFunc("/v2/service_instances/{instance_id}/service_bindings/{binding_id}", a.CreateServiceBinding).Methods("PUT")
 	router.HandleFunc("/v2/service_instances/{instance_id}/service_bindings/{binding_id}", a.DeleteServiceBinding).Methods("DELETE")
 
@@ -57,18 +70,12 @@ func (a *ApiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.Handler.ServeHTTP(w, r)
 }
 
-func writeError(w http.ResponseWriter, err *cf.ServiceProviderError) {
-	if err.Code < 500 {
-		renderer.JSON(w, err.Code, cf.BrokerError{err.String()})
-	}
-}
-
 func (a *ApiHandler) ShowCatalog(w http.ResponseWriter, r *http.Request) {
 	renderer.JSON(w, http.StatusOK, a.Config.Catalog)
 }
 
 func (a *ApiHandler) CreateServiceInstance(w http.ResponseWriter, r *http.Request) {
-	serviceCreationRequest := new(cf.ServiceCreationRequest)
+	serviceCreationRequest := new(ServiceCreationRequest)
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
@@ -78,10 +85,139 @@ func (a *ApiHandler) CreateServiceInstance(w http.ResponseWriter, r *http.Reques
 	json.Unmarshal(body, serviceCreationRequest)
 
 	serviceCreationRequest.InstanceID = mux.Vars(r)["instance_id"]
+	serviceCreationRequest.applyContext()
+
+	_, plan, err := a.Config.Catalog.ResolvePlan(serviceCreationRequest.ServiceID, serviceCreationRequest.PlanID)
+	if err != nil {
+		renderer.JSON(w, http.StatusBadRequest, cf.BrokerError{Description: err.Error()})
+		return
+	}
+
+	if !validateParameters(w, plan.CreateParametersSchema(), serviceCreationRequest.Parameters) {
+		return
+	}
 
-	serviceError := a.Service.CreateService(serviceCreationRequest)
+	_, err = keyspaceSettings(plan, serviceCreationRequest.Parameters)
+	if err != nil {
+		renderer.JSON(w, http.StatusBadRequest, cf.BrokerError{Description: "Invalid parameters: " + err.Error()})
+		return
+	}
+
+	if acceptsIncomplete(r) {
+		// conflicts are answered right away instead of failing the operation in background
+		check, serviceError := a.Service.CheckService(serviceCreationRequest)
+		if serviceError != nil {
+			writeError(w, serviceError)
+			return
+		}
+		if check.Exists {
+			renderer.JSON(w, http.StatusOK, check)
+			return
+		}
+
+		if check.InProgress {
+			a.resumeOperation(w, r, serviceCreationRequest.InstanceID, OperationProvision)
+			return
+		}
+
+		a.startOperation(w, r, serviceCreationRequest.InstanceID, OperationProvision, func() *cf.ServiceProviderError {
+			_, serviceError := a.Service.CreateService(serviceCreationRequest, plan)
+			return serviceError
+		})
+		return
+	}
+
+	serviceCreationResponse, serviceError := a.Service.CreateService(serviceCreationRequest, plan)
+	if serviceError != nil {
+		writeError(w, serviceError)
+	} else if serviceCreationResponse.Exists {
+		renderer.JSON(w, http.StatusOK, serviceCreationResponse)
+	} else {
+		renderer.JSON(w, http.StatusCreated, serviceCreationResponse)
+	}
+}
+
+func (a *ApiHandler) GetServiceInstance(w http.ResponseWriter, r *http.Request) {
+	serviceInstanceResponse, serviceError := a.Service.GetService(mux.Vars(r)["instance_id"])
 	if serviceError == nil {
-		renderer.JSON(w, http.StatusCreated, emptyResponse)
+		renderer.JSON(w, http.StatusOK, serviceInstanceResponse)
+	} else {
+		writeError(w, serviceError)
+	}
+}
+
+func (a *ApiHandler) UpdateServiceInstance(w http.ResponseWriter, r *http.Request) {
+	serviceUpdateRequest := new(ServiceUpdateRequest)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	json.Unmarshal(body, serviceUpdateRequest)
+
+	serviceUpdateRequest.InstanceID = mux.Vars(r)["instance_id"]
+
+	instance, serviceError := a.Service.GetService(serviceUpdateRequest.InstanceID)
+	if serviceError != nil {
+		if serviceError.Code == ErrorNotFound {
+			serviceError = cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(serviceUpdateRequest.InstanceID))
+		}
+		writeError(w, serviceError)
+		return
+	}
+
+	// parameters are updated within the current plan if plan_id is not sent
+	planID := serviceUpdateRequest.PlanID
+	if planID == "" {
+		planID = instance.PlanID
+	}
+	if planID == "" {
+		renderer.JSON(w, http.StatusBadRequest, cf.BrokerError{
+			Description: fmt.Sprintf("plan_id is required, instance %s has no plan recorded", serviceUpdateRequest.InstanceID),
+		})
+		return
+	}
+
+	service, plan, err := a.Config.Catalog.ResolvePlan(serviceUpdateRequest.ServiceID, planID)
+	if err != nil {
+		renderer.JSON(w, http.StatusBadRequest, cf.BrokerError{Description: err.Error()})
+		return
+	}
+
+	if !service.PlanUpdateable && instance.PlanID != "" && instance.PlanID != plan.Id {
+		renderer.JSON(w, 422, cf.BrokerError{
+			Description: fmt.Sprintf("Service %q does not support plan changes", service.Name),
+		})
+		return
+	}
+
+	parameters, err := mergeParameters(instance.Parameters, serviceUpdateRequest.Parameters)
+	if err != nil {
+		renderer.JSON(w, http.StatusBadRequest, cf.BrokerError{Description: "Invalid parameters: " + err.Error()})
+		return
+	}
+
+	if !validateParameters(w, plan.CreateParametersSchema(), parameters) {
+		return
+	}
+
+	_, err = keyspaceSettings(plan, parameters)
+	if err != nil {
+		renderer.JSON(w, http.StatusBadRequest, cf.BrokerError{Description: "Invalid parameters: " + err.Error()})
+		return
+	}
+
+	if acceptsIncomplete(r) {
+		a.startOperation(w, r, serviceUpdateRequest.InstanceID, OperationUpdate, func() *cf.ServiceProviderError {
+			return a.Service.UpdateService(serviceUpdateRequest, plan)
+		})
+		return
+	}
+
+	serviceError = a.Service.UpdateService(serviceUpdateRequest, plan)
+	if serviceError == nil {
+		renderer.JSON(w, http.StatusOK, emptyResponse)
 	} else {
 		writeError(w, serviceError)
 	}
@@ -89,6 +225,24 @@ func (a *ApiHandler) CreateServiceInstance(w http.ResponseWriter, r *http.Reques
 
 func (a *ApiHandler) DeleteServiceInstance(w http.ResponseWriter, r *http.Request) {
 	instanceId := mux.Vars(r)["instance_id"]
+
+	if acceptsIncomplete(r) {
+		exists, serviceError := a.Service.ServiceExists(instanceId)
+		if serviceError != nil {
+			writeError(w, serviceError)
+			return
+		}
+		if !exists {
+			writeError(w, cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(instanceId)))
+			return
+		}
+
+		a.startOperation(w, r, instanceId, OperationDeprovision, func() *cf.ServiceProviderError {
+			return a.Service.DeleteService(instanceId)
+		})
+		return
+	}
+
 	serviceError := a.Service.DeleteService(instanceId)
 	if serviceError == nil {
 		renderer.JSON(w, http.StatusOK, emptyResponse)
@@ -97,10 +251,138 @@ func (a *ApiHandler) DeleteServiceInstance(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+func (a *ApiHandler) LastOperation(w http.ResponseWriter, r *http.Request) {
+	instanceId := mux.Vars(r)["instance_id"]
+
+	operation, err := a.Operations.FindOperation(instanceId, r.URL.Query().Get("operation"))
+	if err != nil {
+		writeError(w, serverError(err))
+		return
+	}
+
+	if operation == nil {
+		writeError(w, cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(instanceId)))
+		return
+	}
+
+	renderer.JSON(w, http.StatusOK, LastOperationResponse{
+		State:       operation.State,
+		Description: operation.Description,
+	})
+}
+
+// validateParameters checks request parameters against the plan schema
+// and answers 400 with the violations found
+func validateParameters(w http.ResponseWriter, parametersSchema map[string]interface{}, parameters map[string]interface{}) bool {
+	if parametersSchema == nil {
+		return true
+	}
+
+	if parameters == nil {
+		parameters = make(map[string]interface{})
+	}
+
+	validationErrors := schema.Validate(parametersSchema, parameters)
+	if len(validationErrors) == 0 {
+		return true
+	}
+
+	messages := make([]string, len(validationErrors))
+	for i, validationError := range validationErrors {
+		messages[i] = validationError.Error()
+	}
+
+	renderer.JSON(w, http.StatusBadRequest, ValidationErrorResponse{
+		Description: "Invalid parameters: " + strings.Join(messages, "; "),
+		Errors:      validationErrors,
+	})
+	return false
+}
+
+func acceptsIncomplete(r *http.Request) bool {
+	return r.URL.Query().Get("accepts_incomplete") == "true"
+}
+
+// startOperation persists a new operation, answers 202 with its id
+// and runs the work in background
+func (a *ApiHandler) startOperation(w http.ResponseWriter, r *http.Request, instanceID, operationType string, work func() *cf.ServiceProviderError) {
+	drain := a.Drain
+	if drain != nil && !drain.Begin() {
+		writeError(w, cf.NewServiceProviderError(ErrorServiceUnavailable, errors.New("broker is shutting down")))
+		return
+	}
+
+	operation, err := a.Operations.CreateOperation(instanceID, operationType)
+	if err != nil {
+		if drain != nil {
+			drain.Done()
+		}
+		writeError(w, serverError(err))
+		return
+	}
+
+	go func() {
+		if drain != nil {
+			defer drain.Done()
+		}
+		a.runOperation(operation, work)
+	}()
+
+	acceptOperation(w, r, operation)
+}
+
+// resumeOperation answers 202 with the running operation of the instance started by identical request,
+// the request is refused if there is no such operation
+func (a *ApiHandler) resumeOperation(w http.ResponseWriter, r *http.Request, instanceID, operationType string) {
+	running, err := a.Operations.FindOperation(instanceID, "")
+	if err != nil {
+		writeError(w, serverError(err))
+		return
+	}
+
+	// identical synchronous request is running, so there is no operation to poll
+	if running == nil || running.State != OperationInProgress || running.Type != operationType {
+		writeError(w, cf.NewServiceProviderError(ErrorConcurrency, errors.New(instanceID)))
+		return
+	}
+
+	acceptOperation(w, r, running)
+}
+
+func acceptOperation(w http.ResponseWriter, r *http.Request, operation *Operation) {
+	response := AsyncOperationResponse{}
+	if RequestAPIVersion(r).AtLeast(2, 7) {
+		response.Operation = operation.ID
+	}
+	renderer.JSON(w, http.StatusAccepted, response)
+}
+
+func (a *ApiHandler) runOperation(operation *Operation, work func() *cf.ServiceProviderError) {
+	defer func() {
+		if r := recover(); r != nil {
+			operation.State = OperationFailed
+			operation.Description = fmt.Sprint(r)
+		}
+
+		err := a.Operations.UpdateOperation(operation)
+		if err != nil && a.Logger != nil {
+			a.Logger.Printf("Failed to update %s operation %s: %s", operation.Type, operation.ID, err)
+		}
+	}()
+
+	serviceError := work()
+	if serviceError == nil {
+		operation.State = OperationSucceeded
+	} else {
+		operation.State = OperationFailed
+		operation.Description = serviceError.String()
+	}
+}
+
 func (a *ApiHandler) CreateServiceBinding(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	serviceBindingRequest := new(cf.ServiceBindingRequest)
+	serviceBindingRequest := new(ServiceBindingRequest)
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
@@ -111,22 +393,91 @@ func (a *ApiHandler) CreateServiceBinding(w http.ResponseWriter, r *http.Request
 
 	serviceBindingRequest.InstanceID = vars["instance_id"]
 	serviceBindingRequest.BindingID = vars["binding_id"]
+	if serviceBindingRequest.AppGUID == "" {
+		serviceBindingRequest.AppGUID = serviceBindingRequest.BindResource.AppGUID
+	}
 
-	serviceBindingResponse, serviceError := a.Service.BindService(serviceBindingRequest)
+	_, plan, err := a.Config.Catalog.ResolvePlan(serviceBindingRequest.ServiceID, serviceBindingRequest.PlanID)
+	if err != nil {
+		renderer.JSON(w, http.StatusBadRequest, cf.BrokerError{Description: err.Error()})
+		return
+	}
 
-	if serviceError == nil {
-		creds := &serviceBindingResponse.Credentials
+	// permissions and lifetime of the binding are limited by the plan the instance is on
+	instance, serviceError := a.Service.GetService(serviceBindingRequest.InstanceID)
+	if serviceError != nil {
+		if serviceError.Code == ErrorNotFound {
+			serviceError = cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(serviceBindingRequest.InstanceID))
+		}
+		writeError(w, serviceError)
+		return
+	}
+	if instance.PlanID != "" && instance.PlanID != plan.Id {
+		renderer.JSON(w, http.StatusBadRequest, cf.BrokerError{
+			Description: fmt.Sprintf("plan_id %s does not match plan %s of instance %s",
+				plan.Id, instance.PlanID, serviceBindingRequest.InstanceID),
+		})
+		return
+	}
+
+	_, err = bindingPermissions(plan, serviceBindingRequest.Parameters)
+	if err == nil {
+		_, err = bindingTTL(plan, serviceBindingRequest.Parameters)
+	}
+	if err != nil {
+		renderer.JSON(w, http.StatusBadRequest, cf.BrokerError{Description: "Invalid parameters: " + err.Error()})
+		return
+	}
+
+	// the CA is read before the binding is created, so a missing file does not leave the binding behind
+	caCertificate, err := a.Config.Cassandra.CACertificate()
+	if err != nil {
+		writeError(w, serverError(err))
+		return
+	}
 
-		creds.Nodes = a.Config.Cassandra.Nodes
-		creds.CqlPort = a.Config.Cassandra.CqlPort
-		creds.ThriftPort = a.Config.Cassandra.ThriftPort
+	serviceBindingResponse, serviceError := a.Service.BindService(serviceBindingRequest, plan)
+
+	if serviceError != nil {
+		writeError(w, serviceError)
+		return
+	}
 
+	a.fillCredentials(&serviceBindingResponse.Credentials, caCertificate)
+	if serviceBindingResponse.Exists {
+		renderer.JSON(w, http.StatusOK, serviceBindingResponse)
+	} else {
 		renderer.JSON(w, http.StatusCreated, serviceBindingResponse)
+	}
+}
+
+func (a *ApiHandler) GetServiceBinding(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	caCertificate, err := a.Config.Cassandra.CACertificate()
+	if err != nil {
+		writeError(w, serverError(err))
+		return
+	}
+
+	serviceBindingResponse, serviceError := a.Service.GetBinding(vars["instance_id"], vars["binding_id"])
+	if serviceError == nil {
+		a.fillCredentials(&serviceBindingResponse.Credentials, caCertificate)
+		renderer.JSON(w, http.StatusOK, serviceBindingResponse)
 	} else {
 		writeError(w, serviceError)
 	}
 }
 
+// fillCredentials adds cluster connection settings to the binding credentials
+func (a *ApiHandler) fillCredentials(creds *ServiceCredentials, caCertificate string) {
+	creds.Nodes = a.Config.Cassandra.Nodes
+	creds.CqlPort = a.Config.Cassandra.CqlPort
+	creds.ThriftPort = a.Config.Cassandra.ThriftPort
+	creds.TLS = a.Config.Cassandra.TLS.Enabled
+	creds.CACertificate = caCertificate
+}
+
 func (a *ApiHandler) DeleteServiceBinding(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
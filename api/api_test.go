@@ -10,26 +10,101 @@ import (
 	"github.com/cloudfoundry-community/types-cf"
 	"github.com/codegangsta/negroni"
 
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 type mockCassandraService struct {
-	InstanceExist bool
-	BindingExist  bool
+	InstanceExist     bool
+	InstanceIdentical bool
+	InstanceCreating  bool
+	BindingExist      bool
+	BindingIdentical  bool
+	CreatedPlan       *config.PlanConfig
+	CreationRequest   *api.ServiceCreationRequest
+	UpdatedPlan       *config.PlanConfig
+	BindingRequest    *api.ServiceBindingRequest
+	BindingPlan       *config.PlanConfig
+	Failure           *cf.ServiceProviderError
 }
 
-func (s *mockCassandraService) CreateService(r *cf.ServiceCreationRequest) *cf.ServiceProviderError {
+func (s *mockCassandraService) CreateService(r *api.ServiceCreationRequest, plan *config.PlanConfig) (*api.ServiceCreationResponse, *cf.ServiceProviderError) {
+	s.CreatedPlan = plan
+	s.CreationRequest = r
+
+	if s.Failure != nil {
+		return nil, s.Failure
+	}
+
+	if s.InstanceIdentical {
+		return &api.ServiceCreationResponse{Exists: true}, nil
+	}
+
+	if s.InstanceExist {
+		return nil, cf.NewServiceProviderError(cf.ErrorInstanceExists, errors.New(r.InstanceID))
+	}
+
+	return &api.ServiceCreationResponse{}, nil
+}
+
+func (s *mockCassandraService) CheckService(r *api.ServiceCreationRequest) (*api.ServiceCreationResponse, *cf.ServiceProviderError) {
+	if s.InstanceCreating {
+		return &api.ServiceCreationResponse{InProgress: true}, nil
+	}
+
+	if s.InstanceIdentical {
+		return &api.ServiceCreationResponse{Exists: true}, nil
+	}
+
 	if s.InstanceExist {
-		return cf.NewServiceProviderError(cf.ErrorInstanceExists, errors.New(r.InstanceID))
+		return nil, cf.NewServiceProviderError(cf.ErrorInstanceExists, errors.New(r.InstanceID))
+	}
+
+	return &api.ServiceCreationResponse{}, nil
+}
+
+func (s *mockCassandraService) ServiceExists(instanceID string) (bool, *cf.ServiceProviderError) {
+	return s.InstanceExist, nil
+}
+
+func (s *mockCassandraService) UpdateService(r *api.ServiceUpdateRequest, plan *config.PlanConfig) *cf.ServiceProviderError {
+	if !s.InstanceExist {
+		return cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(r.InstanceID))
 	}
 
+	s.UpdatedPlan = plan
+
 	return nil
 }
 
+func (s *mockCassandraService) GetService(instanceID string) (*api.ServiceInstanceResponse, *cf.ServiceProviderError) {
+	if !s.InstanceExist {
+		return nil, cf.NewServiceProviderError(api.ErrorNotFound, errors.New(instanceID))
+	}
+
+	response := &api.ServiceInstanceResponse{
+		ServiceID:        "service-id",
+		PlanID:           "plan-id",
+		OrganizationGUID: "org-guid",
+		SpaceGUID:        "space-guid",
+		Context:          map[string]interface{}{"platform": "cloudfoundry"},
+		Parameters:       map[string]interface{}{"foo": "bar"},
+	}
+	return response, nil
+}
+
 func (s *mockCassandraService) DeleteService(instanceID string) *cf.ServiceProviderError {
+	if s.Failure != nil {
+		return s.Failure
+	}
+
 	if !s.InstanceExist {
 		return cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(instanceID))
 	}
@@ -37,15 +112,38 @@ func (s *mockCassandraService) DeleteService(instanceID string) *cf.ServiceProvi
 	return nil
 }
 
-func (s *mockCassandraService) BindService(r *cf.ServiceBindingRequest) (*api.ServiceBindingResponse, *cf.ServiceProviderError) {
+func (s *mockCassandraService) BindService(r *api.ServiceBindingRequest, plan *config.PlanConfig) (*api.ServiceBindingResponse, *cf.ServiceProviderError) {
 	if !s.InstanceExist {
 		return nil, cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(r.InstanceID))
 	}
 
-	if s.BindingExist {
+	if s.BindingExist && !s.BindingIdentical {
 		return nil, cf.NewServiceProviderError(cf.ErrorInstanceExists, errors.New(r.BindingID))
 	}
 
+	s.BindingRequest = r
+	s.BindingPlan = plan
+
+	response := &api.ServiceBindingResponse{
+		Credentials: api.ServiceCredentials{
+			Username: "username",
+			Password: "password",
+			Keyspace: "keyspace",
+		},
+		Exists: s.BindingIdentical,
+	}
+	return response, nil
+}
+
+func (s *mockCassandraService) GetBinding(instanceID, bindingID string) (*api.ServiceBindingResponse, *cf.ServiceProviderError) {
+	if !s.InstanceExist {
+		return nil, cf.NewServiceProviderError(api.ErrorNotFound, errors.New(instanceID))
+	}
+
+	if !s.BindingExist {
+		return nil, cf.NewServiceProviderError(api.ErrorNotFound, errors.New(bindingID))
+	}
+
 	response := &api.ServiceBindingResponse{
 		Credentials: api.ServiceCredentials{
 			Username: "username",
@@ -68,23 +166,96 @@ func (s *mockCassandraService) UnbindService(instanceID, bindingID string) *cf.S
 	return nil
 }
 
+type mockOperationStore struct {
+	sync.Mutex
+	Operations map[string]api.Operation
+}
+
+func (s *mockOperationStore) CreateOperation(instanceID, operationType string) (*api.Operation, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	operation := &api.Operation{
+		ID:         "operation-id",
+		InstanceID: instanceID,
+		Type:       operationType,
+		State:      api.OperationInProgress,
+	}
+	s.Operations[operation.ID] = *operation
+
+	return operation, nil
+}
+
+func (s *mockOperationStore) UpdateOperation(operation *api.Operation) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.Operations[operation.ID] = *operation
+
+	return nil
+}
+
+func (s *mockOperationStore) FindOperation(instanceID, operationID string) (*api.Operation, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, operation := range s.Operations {
+		if operation.InstanceID == instanceID && (operationID == "" || operation.ID == operationID) {
+			return &operation, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *mockOperationStore) State(operationID string) string {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.Operations[operationID].State
+}
+
+const validRequestBody = `{"service_id": "service-id", "plan_id": "plan-id"}`
+
 var _ = Describe("API", func() {
 	var request *http.Request
 	var recorder *httptest.ResponseRecorder
 	var apiInstance api.ApiHandler
 	var cassandraService *mockCassandraService
+	var operationStore *mockOperationStore
+	var drain *api.Drain
 
 	BeforeEach(func() {
 		cassandraService = &mockCassandraService{}
+		operationStore = &mockOperationStore{Operations: make(map[string]api.Operation)}
+		drain = api.NewDrain()
 		apiInstance = api.ApiHandler{
-			Handler: negroni.New(),
-			Service: cassandraService,
-			Config:  &config.Config{},
+			Handler:    negroni.New(),
+			Service:    cassandraService,
+			Operations: operationStore,
+			Config:     &config.Config{},
+			Drain:      drain,
+		}
+		apiInstance.Config.Catalog = config.CatalogConfig{
+			Services: []config.ServiceConfig{
+				config.ServiceConfig{
+					Id:    "service-id",
+					Name:  "cassandra",
+					Plans: []config.PlanConfig{config.PlanConfig{Id: "plan-id", Name: "free"}},
+				},
+			},
 		}
+		Ω(apiInstance.Config.Catalog.Index()).Should(Succeed())
 		apiInstance.DefineRoutes()
 		recorder = httptest.NewRecorder()
 	})
 
+	// operations started by a spec must not outlive it
+	AfterEach(func() {
+		drain.Start()
+		Ω(drain.Wait(time.Second)).To(BeTrue())
+	})
+
 	Describe("GET /v2/catalog", func() {
 		BeforeEach(func() {
 			service := config.ServiceConfig{
@@ -125,6 +296,7 @@ var _ = Describe("API", func() {
 			apiInstance.Config.Catalog = config.CatalogConfig{
 				Services: []config.ServiceConfig{service},
 			}
+			Ω(apiInstance.Config.Catalog.Index()).Should(Succeed())
 
 			request, _ = http.NewRequest("GET", "/v2/catalog", nil)
 			apiInstance.ServeHTTP(recorder, request)
@@ -186,7 +358,7 @@ var _ = Describe("API", func() {
 		Context("Instance does not exist", func() {
 			BeforeEach(func() {
 				cassandraService.InstanceExist = false
-				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", strings.NewReader("{}"))
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", strings.NewReader(validRequestBody))
 				apiInstance.ServeHTTP(recorder, request)
 			})
 
@@ -201,147 +373,1055 @@ var _ = Describe("API", func() {
 			It("returns empty json", func() {
 				Ω(recorder.Body).To(MatchJSON("{}"))
 			})
+
+			It("passes resolved plan to the service", func() {
+				Ω(cassandraService.CreatedPlan.Name).To(Equal("free"))
+			})
 		})
 
-		Context("Instance exists", func() {
+		Context("Request with platform context", func() {
 			BeforeEach(func() {
-				cassandraService.InstanceExist = true
-				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", strings.NewReader("{}"))
+				body := `{"service_id": "service-id", "plan_id": "plan-id",
+					"context": {"platform": "cloudfoundry", "organization_guid": "org-guid", "space_guid": "space-guid"}}`
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", strings.NewReader(body))
 				apiInstance.ServeHTTP(recorder, request)
 			})
 
-			It("returns a status code of 409", func() {
-				Ω(recorder.Code).To(Equal(409))
+			It("passes the context to the service", func() {
+				Ω(cassandraService.CreationRequest.Context).To(HaveKeyWithValue("platform", "cloudfoundry"))
 			})
 
-			It("returns application/json content type", func() {
-				Ω(recorder.Header()["Content-Type"]).To(Equal([]string{"application/json; charset=UTF-8"}))
+			It("takes organization and space from the context", func() {
+				Ω(cassandraService.CreationRequest.OrganizationGUID).To(Equal("org-guid"))
+				Ω(cassandraService.CreationRequest.SpaceGUID).To(Equal("space-guid"))
 			})
+		})
 
-			It("returns empty json", func() {
-				Ω(recorder.Body).To(MatchJSON(`{"description":  "Error: 409 (ErrorInstanceExists) - foobar"}`))
+		Context("Request with organization and space", func() {
+			BeforeEach(func() {
+				body := `{"service_id": "service-id", "plan_id": "plan-id", "organization_guid": "org-guid",
+					"space_guid": "space-guid", "context": {"organization_guid": "other-org-guid"}}`
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", strings.NewReader(body))
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("keeps them over the context", func() {
+				Ω(cassandraService.CreationRequest.OrganizationGUID).To(Equal("org-guid"))
+				Ω(cassandraService.CreationRequest.SpaceGUID).To(Equal("space-guid"))
 			})
 		})
-	})
 
-	Describe("DELETE /service_instances/:instance_id", func() {
-		Context("Instance does not exist", func() {
+		Context("Plan with parameters schema", func() {
 			BeforeEach(func() {
-				cassandraService.InstanceExist = false
-				request, _ = http.NewRequest("DELETE", "/v2/service_instances/foobar", nil)
+				apiInstance.Config.Catalog.Services[0].Plans[0].Schemas = &config.PlanSchemasConfig{
+					ServiceInstance: config.ServiceInstanceSchemasConfig{
+						Create: &config.InputParametersSchemaConfig{
+							Parameters: config.JSONSchema{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"replication_factor": map[string]interface{}{"type": "integer", "maximum": 5},
+								},
+								"additionalProperties": false,
+							},
+						},
+					},
+				}
+			})
+
+			Context("Valid parameters", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "parameters": {"replication_factor": 2}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 201", func() {
+					Ω(recorder.Code).To(Equal(201))
+				})
+			})
+
+			Context("Invalid parameters", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "parameters": {"replication_factor": 7, "foo": 1}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 400", func() {
+					Ω(recorder.Code).To(Equal(400))
+				})
+
+				It("returns json with field-level errors", func() {
+					Ω(recorder.Body).To(MatchJSON(`
+{
+	"description": "Invalid parameters: foo: is not allowed; replication_factor: must be less than or equal to 5",
+	"errors": [
+		{"field": "foo", "message": "is not allowed"},
+		{"field": "replication_factor", "message": "must be less than or equal to 5"}
+	]
+}`))
+				})
+
+				It("does not provision the instance", func() {
+					Ω(cassandraService.CreatedPlan).To(BeNil())
+				})
+			})
+		})
+
+		Context("Parameters not applicable to keyspace", func() {
+			BeforeEach(func() {
+				body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "parameters": {"replication_factor": "two"}}`)
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", body)
 				apiInstance.ServeHTTP(recorder, request)
 			})
 
-			It("returns a status code of 410", func() {
-				Ω(recorder.Code).To(Equal(410))
+			It("returns a status code of 400", func() {
+				Ω(recorder.Code).To(Equal(400))
 			})
+		})
 
-			It("returns empty json", func() {
-				Ω(recorder.Body).To(MatchJSON(`{"description": "Error: 410 (ErrorInstanceNotFound) - foobar"}`))
+		Context("Unknown service", func() {
+			BeforeEach(func() {
+				body := strings.NewReader(`{"service_id": "unknown-id", "plan_id": "plan-id"}`)
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", body)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 400", func() {
+				Ω(recorder.Code).To(Equal(400))
+			})
+
+			It("returns json with error", func() {
+				Ω(recorder.Body).To(MatchJSON(`{"description": "Unknown service_id \"unknown-id\""}`))
+			})
+
+			It("does not provision the instance", func() {
+				Ω(cassandraService.CreatedPlan).To(BeNil())
+			})
+		})
+
+		Context("Unknown plan", func() {
+			BeforeEach(func() {
+				body := strings.NewReader(`{"service_id": "service-id", "plan_id": "unknown-id"}`)
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", body)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 400", func() {
+				Ω(recorder.Code).To(Equal(400))
+			})
+
+			It("returns json with error", func() {
+				Ω(recorder.Body).To(MatchJSON(`{"description": "Unknown plan_id \"unknown-id\" for service \"cassandra\""}`))
 			})
 		})
 
 		Context("Instance exists", func() {
 			BeforeEach(func() {
 				cassandraService.InstanceExist = true
-				request, _ = http.NewRequest("DELETE", "/v2/service_instances/foobar", nil)
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", strings.NewReader(validRequestBody))
 				apiInstance.ServeHTTP(recorder, request)
 			})
 
-			It("returns a status code of 200", func() {
-				Ω(recorder.Code).To(Equal(200))
+			It("returns a status code of 409", func() {
+				Ω(recorder.Code).To(Equal(409))
 			})
 
 			It("returns application/json content type", func() {
 				Ω(recorder.Header()["Content-Type"]).To(Equal([]string{"application/json; charset=UTF-8"}))
 			})
 
+			It("returns empty json", func() {
+				Ω(recorder.Body).To(MatchJSON(`{"description":  "Error: 409 (ErrorInstanceExists) - foobar"}`))
+			})
+		})
+
+		Context("Identical instance exists", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceExist = true
+				cassandraService.InstanceIdentical = true
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", strings.NewReader(validRequestBody))
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 200", func() {
+				Ω(recorder.Code).To(Equal(200))
+			})
+
 			It("returns empty json", func() {
 				Ω(recorder.Body).To(MatchJSON("{}"))
 			})
 		})
 	})
 
-	Describe("PUT /v2/service_instances/:instance_id/service_bindings/:binding_id", func() {
+	Describe("PUT /v2/service_instances/:instance_id?accepts_incomplete=true", func() {
 		Context("Instance does not exist", func() {
 			BeforeEach(func() {
 				cassandraService.InstanceExist = false
-				body := strings.NewReader("{}")
-				request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar?accepts_incomplete=true", strings.NewReader(validRequestBody))
 				apiInstance.ServeHTTP(recorder, request)
 			})
 
-			It("returns a status code of 410", func() {
-				Ω(recorder.Code).To(Equal(410))
+			It("returns a status code of 202", func() {
+				Ω(recorder.Code).To(Equal(202))
 			})
 
-			It("returns application/json content type", func() {
-				Ω(recorder.Header()["Content-Type"]).To(Equal([]string{"application/json; charset=UTF-8"}))
+			It("returns json with operation", func() {
+				Ω(recorder.Body).To(MatchJSON(`{"operation": "operation-id"}`))
 			})
 
-			It("returns empty json", func() {
-				Ω(recorder.Body).To(MatchJSON(`{"description": "Error: 410 (ErrorInstanceNotFound) - foo"}`))
+			It("finishes the operation in background", func() {
+				Eventually(func() string { return operationStore.State("operation-id") }).Should(Equal(api.OperationSucceeded))
 			})
 		})
 
 		Context("Instance exists", func() {
 			BeforeEach(func() {
 				cassandraService.InstanceExist = true
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar?accepts_incomplete=true", strings.NewReader(validRequestBody))
+				apiInstance.ServeHTTP(recorder, request)
 			})
 
-			Context("Binding exists", func() {
+			It("returns a status code of 409", func() {
+				Ω(recorder.Code).To(Equal(409))
+			})
+
+			It("does not start an operation", func() {
+				Ω(operationStore.Operations).To(BeEmpty())
+			})
+		})
+
+		Context("Identical instance exists", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceExist = true
+				cassandraService.InstanceIdentical = true
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar?accepts_incomplete=true", strings.NewReader(validRequestBody))
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 200", func() {
+				Ω(recorder.Code).To(Equal(200))
+			})
+
+			It("does not start an operation", func() {
+				Ω(operationStore.Operations).To(BeEmpty())
+			})
+		})
+
+		Context("Identical instance is being provisioned", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceCreating = true
+			})
+
+			Context("in background", func() {
 				BeforeEach(func() {
-					cassandraService.BindingExist = true
-					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", strings.NewReader("{}"))
+					operationStore.Operations["running-id"] = api.Operation{
+						ID:         "running-id",
+						InstanceID: "foobar",
+						Type:       api.OperationProvision,
+						State:      api.OperationInProgress,
+					}
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar?accepts_incomplete=true", strings.NewReader(validRequestBody))
 					apiInstance.ServeHTTP(recorder, request)
 				})
 
-				It("returns a status code of 409", func() {
-					Ω(recorder.Code).To(Equal(409))
-				})
-
-				It("returns application/json content type", func() {
-					Ω(recorder.Header()["Content-Type"]).To(Equal([]string{"application/json; charset=UTF-8"}))
+				It("returns a status code of 202", func() {
+					Ω(recorder.Code).To(Equal(202))
 				})
 
-				It("returns json with error", func() {
-					Ω(recorder.Body).To(MatchJSON(`{"description":  "Error: 409 (ErrorInstanceExists) - bar"}`))
+				It("returns json with the running operation", func() {
+					Ω(recorder.Body).To(MatchJSON(`{"operation": "running-id"}`))
+					Ω(operationStore.Operations).To(HaveLen(1))
 				})
 			})
 
-			Context("Binding does not exists", func() {
+			Context("synchronously", func() {
 				BeforeEach(func() {
-					apiInstance.Config.Cassandra = config.CassandraConfig{
-						Nodes:      []string{"host1", "host2"},
-						CqlPort:    123,
-						ThriftPort: 456,
-					}
-					cassandraService.InstanceExist = true
-					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", strings.NewReader("{}"))
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar?accepts_incomplete=true", strings.NewReader(validRequestBody))
 					apiInstance.ServeHTTP(recorder, request)
 				})
 
-				It("returns a status code of 201", func() {
-					Ω(recorder.Code).To(Equal(201))
+				It("returns a status code of 422", func() {
+					Ω(recorder.Code).To(Equal(422))
 				})
+			})
+		})
 
-				It("returns application/json content type", func() {
-					Ω(recorder.Header()["Content-Type"]).To(Equal([]string{"application/json; charset=UTF-8"}))
-				})
+		Context("Broker is shutting down", func() {
+			It("waits for the operation to finish", func() {
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar?accepts_incomplete=true", strings.NewReader(validRequestBody))
+				apiInstance.ServeHTTP(recorder, request)
+				drain.Start()
 
-				It("returns json with credentials", func() {
-					Ω(recorder.Body).To(MatchJSON(`
-{
-	"credentials": {
-		"username": "username",
-		"password": "password",
-		"nodes": ["host1", "host2"],
-		"cql_port": 123,
-		"thrift_port": 456,
-		"keyspace": "keyspace"
-	}
-}`))
-				})
+				Ω(drain.Wait(time.Second)).To(BeTrue())
+				Ω(operationStore.State("operation-id")).To(Equal(api.OperationSucceeded))
+			})
+
+			It("refuses new operations", func() {
+				drain.Start()
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar?accepts_incomplete=true", strings.NewReader(validRequestBody))
+				apiInstance.ServeHTTP(recorder, request)
+
+				Ω(recorder.Code).To(Equal(503))
+				Ω(operationStore.Operations).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("GET /v2/service_instances/:instance_id/last_operation", func() {
+		Context("Operation exists", func() {
+			BeforeEach(func() {
+				operationStore.Operations["operation-id"] = api.Operation{
+					ID:          "operation-id",
+					InstanceID:  "foobar",
+					Type:        api.OperationProvision,
+					State:       api.OperationFailed,
+					Description: "failure",
+				}
+				request, _ = http.NewRequest("GET", "/v2/service_instances/foobar/last_operation?operation=operation-id", nil)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 200", func() {
+				Ω(recorder.Code).To(Equal(200))
+			})
+
+			It("returns json with state", func() {
+				Ω(recorder.Body).To(MatchJSON(`{"state": "failed", "description": "failure"}`))
+			})
+		})
+
+		Context("Operation does not exist", func() {
+			BeforeEach(func() {
+				request, _ = http.NewRequest("GET", "/v2/service_instances/foobar/last_operation?operation=operation-id", nil)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 410", func() {
+				Ω(recorder.Code).To(Equal(410))
+			})
+		})
+	})
+
+	Describe("GET /v2/service_instances/:instance_id", func() {
+		Context("Instance exists", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceExist = true
+				request, _ = http.NewRequest("GET", "/v2/service_instances/foobar", nil)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 200", func() {
+				Ω(recorder.Code).To(Equal(200))
+			})
+
+			It("returns json with service, plan, owner and parameters", func() {
+				Ω(recorder.Body).To(MatchJSON(`{
+					"service_id": "service-id",
+					"plan_id": "plan-id",
+					"organization_guid": "org-guid",
+					"space_guid": "space-guid",
+					"context": {"platform": "cloudfoundry"},
+					"parameters": {"foo": "bar"}
+				}`))
+			})
+		})
+
+		Context("Instance does not exist", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceExist = false
+				request, _ = http.NewRequest("GET", "/v2/service_instances/foobar", nil)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 404", func() {
+				Ω(recorder.Code).To(Equal(404))
+			})
+
+			It("returns json with error", func() {
+				Ω(recorder.Body).To(MatchJSON(`{"description": "Error: 404 (ErrorNotFound) - foobar"}`))
+			})
+		})
+	})
+
+	Describe("PATCH /v2/service_instances/:instance_id", func() {
+		BeforeEach(func() {
+			apiInstance.Config.Catalog = config.CatalogConfig{
+				Services: []config.ServiceConfig{
+					config.ServiceConfig{
+						Id:             "service-id",
+						Name:           "cassandra",
+						PlanUpdateable: true,
+						Plans: []config.PlanConfig{
+							config.PlanConfig{Id: "plan-id", Name: "free"},
+							config.PlanConfig{Id: "small-id", Name: "small"},
+							config.PlanConfig{Id: "large-id", Name: "large"},
+						},
+					},
+				},
+			}
+			Ω(apiInstance.Config.Catalog.Index()).Should(Succeed())
+		})
+
+		Context("Instance exists", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceExist = true
+			})
+
+			Context("Plan exists", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "large-id", "previous_values": {"plan_id": "small-id"}}`)
+					request, _ = http.NewRequest("PATCH", "/v2/service_instances/foobar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 200", func() {
+					Ω(recorder.Code).To(Equal(200))
+				})
+
+				It("returns empty json", func() {
+					Ω(recorder.Body).To(MatchJSON("{}"))
+				})
+
+				It("passes target plan to the service", func() {
+					Ω(cassandraService.UpdatedPlan.Name).To(Equal("large"))
+				})
+			})
+
+			Context("Plan does not exist", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "unknown-id"}`)
+					request, _ = http.NewRequest("PATCH", "/v2/service_instances/foobar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 400", func() {
+					Ω(recorder.Code).To(Equal(400))
+				})
+
+				It("returns json with error", func() {
+					Ω(recorder.Body).To(MatchJSON(`{"description": "Unknown plan_id \"unknown-id\" for service \"cassandra\""}`))
+				})
+			})
+
+			Context("Service does not exist", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "unknown-id", "plan_id": "large-id"}`)
+					request, _ = http.NewRequest("PATCH", "/v2/service_instances/foobar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 400", func() {
+					Ω(recorder.Code).To(Equal(400))
+				})
+			})
+
+			Context("Service is not plan updateable", func() {
+				BeforeEach(func() {
+					apiInstance.Config.Catalog.Services[0].PlanUpdateable = false
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "large-id", "previous_values": {"plan_id": "small-id"}}`)
+					request, _ = http.NewRequest("PATCH", "/v2/service_instances/foobar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 422", func() {
+					Ω(recorder.Code).To(Equal(422))
+				})
+			})
+
+			Context("Service is not plan updateable and previous values are not sent", func() {
+				BeforeEach(func() {
+					apiInstance.Config.Catalog.Services[0].PlanUpdateable = false
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "large-id"}`)
+					request, _ = http.NewRequest("PATCH", "/v2/service_instances/foobar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("compares with the stored plan", func() {
+					Ω(recorder.Code).To(Equal(422))
+					Ω(cassandraService.UpdatedPlan).To(BeNil())
+				})
+			})
+
+			Context("Parameters are updated", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "parameters": {"foo": "bar", "replication_factor": 2}}`)
+					request, _ = http.NewRequest("PATCH", "/v2/service_instances/foobar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 200", func() {
+					Ω(recorder.Code).To(Equal(200))
+				})
+
+				It("keeps the stored plan", func() {
+					Ω(cassandraService.UpdatedPlan.Id).To(Equal("plan-id"))
+				})
+			})
+
+			Context("Parameter which can't be updated is changed", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "parameters": {"foo": "baz"}}`)
+					request, _ = http.NewRequest("PATCH", "/v2/service_instances/foobar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 400", func() {
+					Ω(recorder.Code).To(Equal(400))
+				})
+
+				It("returns json with error", func() {
+					Ω(recorder.Body).To(MatchJSON(`{"description": "Invalid parameters: parameter \"foo\" can not be updated"}`))
+				})
+			})
+
+			Context("Parameters are invalid", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "parameters": {"replication_factor": -1}}`)
+					request, _ = http.NewRequest("PATCH", "/v2/service_instances/foobar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 400", func() {
+					Ω(recorder.Code).To(Equal(400))
+					Ω(cassandraService.UpdatedPlan).To(BeNil())
+				})
+			})
+		})
+
+		Context("Instance does not exist", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceExist = false
+				body := strings.NewReader(`{"service_id": "service-id", "plan_id": "large-id"}`)
+				request, _ = http.NewRequest("PATCH", "/v2/service_instances/foobar", body)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 410", func() {
+				Ω(recorder.Code).To(Equal(410))
+			})
+		})
+	})
+
+	Describe("DELETE /service_instances/:instance_id", func() {
+		Context("Instance does not exist", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceExist = false
+				request, _ = http.NewRequest("DELETE", "/v2/service_instances/foobar", nil)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 410", func() {
+				Ω(recorder.Code).To(Equal(410))
+			})
+
+			It("returns empty json", func() {
+				Ω(recorder.Body).To(MatchJSON(`{"description": "Error: 410 (ErrorInstanceNotFound) - foobar"}`))
+			})
+		})
+
+		Context("Instance exists", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceExist = true
+				request, _ = http.NewRequest("DELETE", "/v2/service_instances/foobar", nil)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 200", func() {
+				Ω(recorder.Code).To(Equal(200))
+			})
+
+			It("returns application/json content type", func() {
+				Ω(recorder.Header()["Content-Type"]).To(Equal([]string{"application/json; charset=UTF-8"}))
+			})
+
+			It("returns empty json", func() {
+				Ω(recorder.Body).To(MatchJSON("{}"))
+			})
+		})
+	})
+
+	Describe("PUT /service_instances/:instance_id concurrently", func() {
+		BeforeEach(func() {
+			cassandraService.Failure = cf.NewServiceProviderError(api.ErrorConcurrency, errors.New("foobar"))
+			request, _ = http.NewRequest("PUT", "/v2/service_instances/foobar", strings.NewReader(validRequestBody))
+			apiInstance.ServeHTTP(recorder, request)
+		})
+
+		It("returns a status code of 422", func() {
+			Ω(recorder.Code).To(Equal(422))
+		})
+
+		It("returns json with ConcurrencyError", func() {
+			var response api.ErrorResponse
+			Ω(json.Unmarshal(recorder.Body.Bytes(), &response)).Should(Succeed())
+			Ω(response.Error).To(Equal("ConcurrencyError"))
+		})
+	})
+
+	Describe("DELETE /service_instances/:instance_id failures", func() {
+		Context("Cassandra is unavailable", func() {
+			BeforeEach(func() {
+				cassandraService.Failure = cf.NewServiceProviderError(api.ErrorServiceUnavailable, errors.New("no hosts available"))
+				request, _ = http.NewRequest("DELETE", "/v2/service_instances/foobar", nil)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 503", func() {
+				Ω(recorder.Code).To(Equal(503))
+			})
+
+			It("asks to retry later", func() {
+				Ω(recorder.Header().Get("Retry-After")).To(Equal("30"))
+			})
+
+			It("returns json with error and description", func() {
+				var response api.ErrorResponse
+				Ω(json.Unmarshal(recorder.Body.Bytes(), &response)).Should(Succeed())
+				Ω(response.Error).To(Equal("ServiceUnavailable"))
+				Ω(response.CorrelationID).To(HaveLen(16))
+				Ω(response.Description).To(Equal("Error: 503 (ErrorServiceUnavailable) - no hosts available (correlation id " + response.CorrelationID + ")"))
+			})
+		})
+
+		Context("Cassandra fails", func() {
+			BeforeEach(func() {
+				cassandraService.Failure = cf.NewServiceProviderError(cf.ErrorServerException, errors.New("syntax error"))
+				request, _ = http.NewRequest("DELETE", "/v2/service_instances/foobar", nil)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 500", func() {
+				Ω(recorder.Code).To(Equal(500))
+			})
+
+			It("returns json with error", func() {
+				var response api.ErrorResponse
+				Ω(json.Unmarshal(recorder.Body.Bytes(), &response)).Should(Succeed())
+				Ω(response.Error).To(Equal("InternalServerError"))
+				Ω(response.Description).To(ContainSubstring("syntax error"))
+			})
+		})
+	})
+
+	Describe("DELETE /service_instances/:instance_id?accepts_incomplete=true", func() {
+		Context("Instance exists", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceExist = true
+				request, _ = http.NewRequest("DELETE", "/v2/service_instances/foobar?accepts_incomplete=true", nil)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 202", func() {
+				Ω(recorder.Code).To(Equal(202))
+			})
+
+			It("returns json with operation", func() {
+				Ω(recorder.Body).To(MatchJSON(`{"operation": "operation-id"}`))
+			})
+
+			It("finishes the operation in background", func() {
+				Eventually(func() string { return operationStore.State("operation-id") }).Should(Equal(api.OperationSucceeded))
+			})
+		})
+
+		Context("Instance does not exist", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceExist = false
+				request, _ = http.NewRequest("DELETE", "/v2/service_instances/foobar?accepts_incomplete=true", nil)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 410", func() {
+				Ω(recorder.Code).To(Equal(410))
+			})
+
+			It("does not start an operation", func() {
+				Ω(operationStore.Operations).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("PUT /v2/service_instances/:instance_id/service_bindings/:binding_id", func() {
+		Context("Instance does not exist", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceExist = false
+				body := strings.NewReader(validRequestBody)
+				request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 410", func() {
+				Ω(recorder.Code).To(Equal(410))
+			})
+
+			It("returns application/json content type", func() {
+				Ω(recorder.Header()["Content-Type"]).To(Equal([]string{"application/json; charset=UTF-8"}))
+			})
+
+			It("returns empty json", func() {
+				Ω(recorder.Body).To(MatchJSON(`{"description": "Error: 410 (ErrorInstanceNotFound) - foo"}`))
+			})
+		})
+
+		Context("Instance exists", func() {
+			BeforeEach(func() {
+				cassandraService.InstanceExist = true
+			})
+
+			Context("Binding exists", func() {
+				BeforeEach(func() {
+					cassandraService.BindingExist = true
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", strings.NewReader(validRequestBody))
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 409", func() {
+					Ω(recorder.Code).To(Equal(409))
+				})
+
+				It("returns application/json content type", func() {
+					Ω(recorder.Header()["Content-Type"]).To(Equal([]string{"application/json; charset=UTF-8"}))
+				})
+
+				It("returns json with error", func() {
+					Ω(recorder.Body).To(MatchJSON(`{"description":  "Error: 409 (ErrorInstanceExists) - bar"}`))
+				})
+			})
+
+			Context("Identical binding exists", func() {
+				BeforeEach(func() {
+					cassandraService.BindingExist = true
+					cassandraService.BindingIdentical = true
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", strings.NewReader(validRequestBody))
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 200", func() {
+					Ω(recorder.Code).To(Equal(200))
+				})
+
+				It("returns json with issued credentials", func() {
+					Ω(recorder.Body).To(MatchJSON(`
+{
+	"credentials": {
+		"username": "username",
+		"password": "password",
+		"nodes": null,
+		"cql_port": 0,
+		"thrift_port": 0,
+		"keyspace": "keyspace"
+	}
+}`))
+				})
+			})
+
+			Context("Binding request with bind_resource", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "bind_resource": {"app_guid": "app-guid"}, "parameters": {"foo": "bar"}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("passes app guid and parameters to the service", func() {
+					Ω(cassandraService.BindingRequest.AppGUID).To(Equal("app-guid"))
+					Ω(cassandraService.BindingRequest.Parameters).To(Equal(map[string]interface{}{"foo": "bar"}))
+				})
+
+				It("passes resolved plan to the service", func() {
+					Ω(cassandraService.BindingPlan.Name).To(Equal("free"))
+				})
+			})
+
+			Context("Binding request with platform context", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id",
+						"bind_resource": {"route": "example.com"}, "context": {"platform": "cloudfoundry"}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("passes route and context to the service", func() {
+					Ω(cassandraService.BindingRequest.BindResource.Route).To(Equal("example.com"))
+					Ω(cassandraService.BindingRequest.Context).To(Equal(map[string]interface{}{"platform": "cloudfoundry"}))
+				})
+			})
+
+			Context("Binding request with permissions not allowed for the plan", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "parameters": {"role": "readonly"}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 400", func() {
+					Ω(recorder.Code).To(Equal(400))
+				})
+
+				It("returns json with error", func() {
+					Ω(recorder.Body).To(MatchJSON(`{"description": "Invalid parameters: role \"readonly\" is not allowed for plan \"free\", expected one of full"}`))
+				})
+
+				It("does not bind the instance", func() {
+					Ω(cassandraService.BindingRequest).To(BeNil())
+				})
+			})
+
+			Context("Binding request with permissions allowed for the plan", func() {
+				BeforeEach(func() {
+					apiInstance.Config.Catalog.Services[0].Plans[0].PermissionProfiles = []string{"readwrite"}
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "parameters": {"permissions": ["select"]}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("binds the instance", func() {
+					Ω(recorder.Code).To(Equal(201))
+					Ω(cassandraService.BindingRequest.Parameters).To(Equal(map[string]interface{}{
+						"permissions": []interface{}{"select"},
+					}))
+				})
+			})
+
+			Context("Binding request with permissions exceeding the plan", func() {
+				BeforeEach(func() {
+					apiInstance.Config.Catalog.Services[0].Plans[0].PermissionProfiles = []string{"readonly"}
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "parameters": {"permissions": ["SELECT", "DROP"]}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 400", func() {
+					Ω(recorder.Code).To(Equal(400))
+				})
+
+				It("returns json with error", func() {
+					Ω(recorder.Body).To(MatchJSON(`{"description": "Invalid parameters: permissions DROP, SELECT are not allowed for plan \"free\""}`))
+				})
+			})
+
+			Context("Binding request with table permissions", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "parameters": {"tables": {"events": ["MODIFY"]}}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("binds the instance", func() {
+					Ω(recorder.Code).To(Equal(201))
+				})
+			})
+
+			Context("Binding request with invalid table permissions", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "parameters": {"tables": {"events": ["CREATE"]}}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 400", func() {
+					Ω(recorder.Code).To(Equal(400))
+				})
+
+				It("returns json with error", func() {
+					Ω(recorder.Body).To(MatchJSON(`{"description": "Invalid parameters: table events: permission CREATE can not be granted on a table"}`))
+				})
+			})
+
+			Context("Binding request with invalid table name", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "parameters": {"tables": {"events; DROP": ["SELECT"]}}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 400", func() {
+					Ω(recorder.Code).To(Equal(400))
+				})
+			})
+
+			Context("Binding request with ttl", func() {
+				BeforeEach(func() {
+					apiInstance.Config.Catalog.Services[0].Plans[0].MaxBindingTTL = 72 * time.Hour
+				})
+
+				It("binds the instance if ttl is allowed for the plan", func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "parameters": {"ttl": "24h"}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+					Ω(recorder.Code).To(Equal(201))
+				})
+
+				It("returns a status code of 400 if ttl exceeds maximum of the plan", func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "parameters": {"ttl": "96h"}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+					Ω(recorder.Code).To(Equal(400))
+					Ω(recorder.Body).To(MatchJSON(`{"description": "Invalid parameters: ttl 96h0m0s exceeds maximum 72h0m0s of plan \"free\""}`))
+				})
+
+				It("returns a status code of 400 for malformed ttl", func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "plan-id", "parameters": {"ttl": "3 days"}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+					Ω(recorder.Code).To(Equal(400))
+				})
+			})
+
+			Context("Binding request with another plan than the instance", func() {
+				BeforeEach(func() {
+					apiInstance.Config.Catalog.Services[0].Plans = append(apiInstance.Config.Catalog.Services[0].Plans,
+						config.PlanConfig{Id: "large-id", Name: "large", PermissionProfiles: []string{"readonly", "full"}})
+					Ω(apiInstance.Config.Catalog.Index()).Should(Succeed())
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "large-id", "parameters": {"role": "readonly"}}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 400", func() {
+					Ω(recorder.Code).To(Equal(400))
+					Ω(recorder.Body).To(MatchJSON(`{"description": "plan_id large-id does not match plan plan-id of instance foo"}`))
+				})
+
+				It("does not bind the instance", func() {
+					Ω(cassandraService.BindingRequest).To(BeNil())
+				})
+			})
+
+			Context("Binding request with unknown plan", func() {
+				BeforeEach(func() {
+					body := strings.NewReader(`{"service_id": "service-id", "plan_id": "unknown-id"}`)
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", body)
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 400", func() {
+					Ω(recorder.Code).To(Equal(400))
+				})
+
+				It("does not bind the instance", func() {
+					Ω(cassandraService.BindingRequest).To(BeNil())
+				})
+			})
+
+			Context("Binding does not exists", func() {
+				BeforeEach(func() {
+					apiInstance.Config.Cassandra = config.CassandraConfig{
+						Nodes:      []string{"host1", "host2"},
+						CqlPort:    123,
+						ThriftPort: 456,
+					}
+					cassandraService.InstanceExist = true
+					request, _ = http.NewRequest("PUT", "/v2/service_instances/foo/service_bindings/bar", strings.NewReader(validRequestBody))
+					apiInstance.ServeHTTP(recorder, request)
+				})
+
+				It("returns a status code of 201", func() {
+					Ω(recorder.Code).To(Equal(201))
+				})
+
+				It("returns application/json content type", func() {
+					Ω(recorder.Header()["Content-Type"]).To(Equal([]string{"application/json; charset=UTF-8"}))
+				})
+
+				It("returns json with credentials", func() {
+					Ω(recorder.Body).To(MatchJSON(`
+{
+	"credentials": {
+		"username": "username",
+		"password": "password",
+		"nodes": ["host1", "host2"],
+		"cql_port": 123,
+		"thrift_port": 456,
+		"keyspace": "keyspace"
+	}
+}`))
+				})
+			})
+		})
+	})
+
+	Describe("GET /v2/service_instances/:instance_id/service_bindings/:binding_id", func() {
+		BeforeEach(func() {
+			apiInstance.Config.Cassandra = config.CassandraConfig{
+				Nodes:      []string{"host1"},
+				CqlPort:    123,
+				ThriftPort: 456,
+			}
+			cassandraService.InstanceExist = true
+		})
+
+		Context("Binding exists", func() {
+			BeforeEach(func() {
+				cassandraService.BindingExist = true
+				request, _ = http.NewRequest("GET", "/v2/service_instances/foo/service_bindings/bar", nil)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 200", func() {
+				Ω(recorder.Code).To(Equal(200))
+			})
+
+			It("returns json with credentials", func() {
+				Ω(recorder.Body).To(MatchJSON(`
+{
+	"credentials": {
+		"username": "username",
+		"password": "password",
+		"nodes": ["host1"],
+		"cql_port": 123,
+		"thrift_port": 456,
+		"keyspace": "keyspace"
+	}
+}`))
+			})
+		})
+
+		Context("Cluster requires TLS", func() {
+			var caFile *os.File
+
+			BeforeEach(func() {
+				var err error
+				caFile, err = ioutil.TempFile("", "ca")
+				Ω(err).ShouldNot(HaveOccurred())
+				caFile.WriteString("-----BEGIN CERTIFICATE-----\n")
+				caFile.Close()
+
+				apiInstance.Config.Cassandra.TLS = config.CassandraTLSConfig{Enabled: true, CAFile: caFile.Name(), ShareCA: true}
+				cassandraService.BindingExist = true
+			})
+
+			AfterEach(func() {
+				os.Remove(caFile.Name())
+			})
+
+			It("returns credentials with TLS flag and CA certificate", func() {
+				request, _ = http.NewRequest("GET", "/v2/service_instances/foo/service_bindings/bar", nil)
+				apiInstance.ServeHTTP(recorder, request)
+
+				Ω(recorder.Code).To(Equal(200))
+				Ω(recorder.Body.String()).To(ContainSubstring(`"tls": true`))
+				Ω(recorder.Body.String()).To(ContainSubstring(`"ca_certificate": "-----BEGIN CERTIFICATE-----\n"`))
+			})
+
+			It("returns a status code of 500 if the CA file is missing", func() {
+				os.Remove(caFile.Name())
+				request, _ = http.NewRequest("GET", "/v2/service_instances/foo/service_bindings/bar", nil)
+				apiInstance.ServeHTTP(recorder, request)
+
+				Ω(recorder.Code).To(Equal(500))
+			})
+		})
+
+		Context("Binding does not exist", func() {
+			BeforeEach(func() {
+				cassandraService.BindingExist = false
+				request, _ = http.NewRequest("GET", "/v2/service_instances/foo/service_bindings/bar", nil)
+				apiInstance.ServeHTTP(recorder, request)
+			})
+
+			It("returns a status code of 404", func() {
+				Ω(recorder.Code).To(Equal(404))
 			})
 		})
 	})
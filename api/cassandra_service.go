@@ -1,32 +1,125 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/Altoros/cf-cassandra-broker/config"
 	"github.com/Altoros/cf-cassandra-broker/random"
+	"github.com/Altoros/cf-cassandra-broker/schema"
 	"github.com/cloudfoundry-community/types-cf"
 	"github.com/gocql/gocql"
 )
 
 type ServiceProvider interface {
 	// CreateService creates a service instance for specific plan
-	CreateService(r *cf.ServiceCreationRequest) *cf.ServiceProviderError
+	CreateService(r *ServiceCreationRequest, plan *config.PlanConfig) (*ServiceCreationResponse, *cf.ServiceProviderError)
+
+	// CheckService reports without changing anything whether the service instance is free to be created,
+	// already exists or is being provisioned by identical request
+	CheckService(r *ServiceCreationRequest) (*ServiceCreationResponse, *cf.ServiceProviderError)
+
+	// ServiceExists reports whether the service instance exists,
+	// leftovers of the failed provisioning included
+	ServiceExists(instanceID string) (bool, *cf.ServiceProviderError)
+
+	// UpdateService moves service instance to the given plan
+	// and applies updated parameters to its keyspace
+	UpdateService(r *ServiceUpdateRequest, plan *config.PlanConfig) *cf.ServiceProviderError
+
+	// GetService returns service and plan of the service instance
+	// and parameters it was provisioned with
+	GetService(instanceID string) (*ServiceInstanceResponse, *cf.ServiceProviderError)
 
 	// DeleteService deletes previously created service instance
 	DeleteService(instanceID string) *cf.ServiceProviderError
 
 	// BindService binds to specified service instance and
 	// Returns credentials necessary to establish connection to that service
-	BindService(r *cf.ServiceBindingRequest) (*ServiceBindingResponse, *cf.ServiceProviderError)
+	BindService(r *ServiceBindingRequest, plan *config.PlanConfig) (*ServiceBindingResponse, *cf.ServiceProviderError)
+
+	// GetBinding returns credentials of previously created binding
+	GetBinding(instanceID, bindingID string) (*ServiceBindingResponse, *cf.ServiceProviderError)
 
 	// UnbindService removes previously created binding
 	UnbindService(instanceID, bindingID string) *cf.ServiceProviderError
 }
 
+// ServiceCreationRequest describes Cloud Foundry service provisioning request
+type ServiceCreationRequest struct {
+	InstanceID       string                 `json:"-"`
+	ServiceID        string                 `json:"service_id"`
+	PlanID           string                 `json:"plan_id"`
+	OrganizationGUID string                 `json:"organization_guid"`
+	SpaceGUID        string                 `json:"space_guid"`
+	Context          map[string]interface{} `json:"context"`
+	Parameters       map[string]interface{} `json:"parameters"`
+}
+
+type ValidationErrorResponse struct {
+	Description string                   `json:"description"`
+	Errors      []schema.ValidationError `json:"errors"`
+}
+
+type ServiceCreationResponse struct {
+	// Exists is set if identical service instance had been already provisioned
+	Exists bool `json:"-"`
+
+	// InProgress is set if identical service instance is being provisioned
+	InProgress bool `json:"-"`
+}
+
+// ServiceUpdateRequest describes Cloud Foundry service update request
+type ServiceUpdateRequest struct {
+	InstanceID     string                 `json:"-"`
+	ServiceID      string                 `json:"service_id"`
+	PlanID         string                 `json:"plan_id"`
+	Parameters     map[string]interface{} `json:"parameters"`
+	PreviousValues ServicePreviousValues  `json:"previous_values"`
+}
+
+type ServicePreviousValues struct {
+	ServiceID string `json:"service_id"`
+	PlanID    string `json:"plan_id"`
+}
+
+// ServiceBindingRequest describes Cloud Foundry service binding request
+type ServiceBindingRequest struct {
+	InstanceID   string                 `json:"-"`
+	BindingID    string                 `json:"-"`
+	ServiceID    string                 `json:"service_id"`
+	PlanID       string                 `json:"plan_id"`
+	AppGUID      string                 `json:"app_guid"`
+	BindResource BindResource           `json:"bind_resource"`
+	Context      map[string]interface{} `json:"context"`
+	Parameters   map[string]interface{} `json:"parameters"`
+}
+
+type BindResource struct {
+	AppGUID string `json:"app_guid"`
+	Route   string `json:"route"`
+}
+
+type ServiceInstanceResponse struct {
+	ServiceID        string                 `json:"service_id"`
+	PlanID           string                 `json:"plan_id"`
+	OrganizationGUID string                 `json:"organization_guid,omitempty"`
+	SpaceGUID        string                 `json:"space_guid,omitempty"`
+	Context          map[string]interface{} `json:"context,omitempty"`
+	Parameters       map[string]interface{} `json:"parameters,omitempty"`
+}
+
 type ServiceBindingResponse struct {
-	Credentials ServiceCredentials `json:"credentials"`
+	Credentials ServiceCredentials     `json:"credentials"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+
+	// Exists is set if identical binding had been already created
+	Exists bool `json:"-"`
 }
 
 type ServiceCredentials struct {
@@ -36,59 +129,327 @@ type ServiceCredentials struct {
 	Username   string   `json:"username"`
 	Password   string   `json:"password"`
 	Keyspace   string   `json:"keyspace"`
+
+	// TLS is set if the cluster requires client-to-node encryption
+	TLS           bool   `json:"tls,omitempty"`
+	CACertificate string `json:"ca_certificate,omitempty"`
 }
 
 type cassandraService struct {
-	session *gocql.Session
+	session     *gocql.Session
+	dialect     Dialect
+	rotation    config.RotationConfig
+	consistency config.ConsistencyConfig
+
+	keyspaceNameTemplate string
+}
+
+func newCassandraService(appConfig *config.Config, session *gocql.Session, dialect Dialect) *cassandraService {
+	return &cassandraService{
+		session:              session,
+		dialect:              dialect,
+		rotation:             appConfig.Rotation,
+		consistency:          appConfig.Cassandra.Consistency,
+		keyspaceNameTemplate: appConfig.KeyspaceNameTemplate,
+	}
 }
 
+// keyspaceNameAttempts limits random suffixes tried for a keyspace name before giving up
+const keyspaceNameAttempts = 5
+
 // CreateService creates a service instance for specific plan
-func (service *cassandraService) CreateService(r *cf.ServiceCreationRequest) *cf.ServiceProviderError {
+func (service *cassandraService) CreateService(r *ServiceCreationRequest, plan *config.PlanConfig) (*ServiceCreationResponse, *cf.ServiceProviderError) {
 	var err error
 
-	if service.isInstanceExist(r.InstanceID) {
-		return cf.NewServiceProviderError(cf.ErrorInstanceExists, errors.New(r.InstanceID))
+	parameters, err := marshalParameters(r.Parameters)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	settings, err := keyspaceSettings(plan, r.Parameters)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	context, err := marshalParameters(r.Context)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	err = service.reclaimInstance(r.InstanceID)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	keyspace, err := service.keyspaceName(r, plan)
+	if err != nil {
+		return nil, serverError(err)
 	}
+	role := service.instanceRole(keyspace)
+	createdAt := time.Now()
+	undo := new(rollback)
+
+	// the instance is registered before the keyspace is created,
+	// so concurrent requests for the same instance never create two keyspaces
+	// and deprovisioning is able to find and drop the keyspace if provisioning fails
+	existing := make(map[string]interface{})
+	applied, err := service.session.Query(`INSERT INTO
+		instances(id, keyspace_name, role_name, service_id, plan_id, organization_guid, space_guid, platform, context,
+			parameters, state, created_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS`,
+		r.InstanceID, keyspace, role, r.ServiceID, r.PlanID, r.OrganizationGUID, r.SpaceGUID,
+		contextString(r.Context, "platform"), context, parameters, stateCreating, createdAt).MapScanCAS(existing)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	if !applied {
+		if stringColumn(existing, "state") == stateCreating {
+			return nil, cf.NewServiceProviderError(ErrorConcurrency, errors.New(r.InstanceID))
+		}
+		return compareInstance(existing, r, parameters)
+	}
+	undo.add("delete instance "+r.InstanceID, func() error {
+		return service.deleteRecord("instances", r.InstanceID, createdAt)
+	})
+
+	dropKeyspace := func() error {
+		return service.dropKeyspaceIfExist(keyspace)
+	}
+
+	query := "CREATE KEYSPACE " + keyspace + " WITH " + keyspaceOptions(settings) + ";"
+	err = service.ddlQuery(query).Exec()
+	if err != nil {
+		// the keyspace might have been created even though the request failed,
+		// unless it has been created by someone else meanwhile
+		if _, exists := err.(*gocql.RequestErrAlreadyExists); !exists {
+			undo.add("drop keyspace "+keyspace, dropKeyspace)
+		}
+		return nil, serverError(undo.fail(err))
+	}
+	undo.add("drop keyspace "+keyspace, dropKeyspace)
+
+	// the instance role holds keyspace permissions inherited by the bindings
+	if roles, ok := service.dialect.(RoleDialect); ok {
+		undo.add("drop role "+role, func() error {
+			return service.ddlQuery(roles.DropRole(role)).Exec()
+		})
 
-	keyspace := "cf" + random.Hex(10)
+		_, err = service.grantInstanceRole(r.InstanceID, keyspace, role)
+		if err != nil {
+			return nil, serverError(undo.fail(err))
+		}
+	}
+
+	err = service.finishRecord("instances", r.InstanceID, createdAt)
+	if err != nil {
+		return nil, serverError(undo.fail(err))
+	}
+
+	return &ServiceCreationResponse{}, nil
+}
+
+// CheckService reports without changing anything whether the service instance is free to be created,
+// already exists or is being provisioned by identical request
+func (service *cassandraService) CheckService(r *ServiceCreationRequest) (*ServiceCreationResponse, *cf.ServiceProviderError) {
+	parameters, err := marshalParameters(r.Parameters)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	existing := make(map[string]interface{})
+	query := "SELECT service_id, plan_id, parameters, state, created_at FROM instances WHERE id = ?"
+	err = service.readQuery(query, r.InstanceID).MapScan(existing)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return &ServiceCreationResponse{}, nil
+		}
+		return nil, serverError(err)
+	}
+
+	// leftovers of failed provisioning are reclaimed by CreateService
+	createdAt, _ := existing["created_at"].(time.Time)
+	if stringColumn(existing, "state") == stateCreating && isStale(createdAt) {
+		return &ServiceCreationResponse{}, nil
+	}
+
+	return compareInstance(existing, r, parameters)
+}
+
+// compareInstance compares the stored instance with the creation request,
+// identical instance still being provisioned is reported as InProgress
+func compareInstance(existing map[string]interface{}, r *ServiceCreationRequest, parameters string) (*ServiceCreationResponse, *cf.ServiceProviderError) {
+	if stringColumn(existing, "service_id") != r.ServiceID || stringColumn(existing, "plan_id") != r.PlanID ||
+		!equalParameters(stringColumn(existing, "parameters"), parameters) {
+		return nil, cf.NewServiceProviderError(cf.ErrorInstanceExists, errors.New(r.InstanceID))
+	}
+
+	if stringColumn(existing, "state") == stateCreating {
+		return &ServiceCreationResponse{InProgress: true}, nil
+	}
+	return &ServiceCreationResponse{Exists: true}, nil
+}
+
+// ServiceExists reports whether the service instance exists,
+// leftovers of the failed provisioning included
+func (service *cassandraService) ServiceExists(instanceID string) (bool, *cf.ServiceProviderError) {
+	var state string
+
+	err := service.readQuery("SELECT state FROM instances WHERE id = ?", instanceID).Scan(&state)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return false, nil
+		}
+		return false, serverError(err)
+	}
+
+	return true, nil
+}
+
+// UpdateService moves service instance to the given plan
+// and applies updated parameters to its keyspace
+func (service *cassandraService) UpdateService(r *ServiceUpdateRequest, plan *config.PlanConfig) *cf.ServiceProviderError {
+	var keyspace, role, serviceID, planID, storedParameters, state string
+
+	query := "SELECT keyspace_name, role_name, service_id, plan_id, parameters, state FROM instances WHERE id = ?"
+	err := service.readQuery(query, r.InstanceID).Scan(&keyspace, &role, &serviceID, &planID, &storedParameters, &state)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(r.InstanceID))
+		}
+		return serverError(err)
+	}
+
+	if state == stateCreating {
+		return cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(r.InstanceID))
+	}
+
+	// instances provisioned before service ids were stored match any service
+	if serviceID != "" && serviceID != r.ServiceID {
+		return cf.NewServiceProviderError(ErrorBadRequest,
+			fmt.Errorf("service_id %q does not match service %q of instance %s", r.ServiceID, serviceID, r.InstanceID))
+	}
+
+	if plan.Id == planID && len(r.Parameters) == 0 {
+		return nil
+	}
+
+	stored, err := unmarshalParameters(storedParameters)
+	if err != nil {
+		return serverError(err)
+	}
+
+	updated, err := mergeParameters(stored, r.Parameters)
+	if err != nil {
+		return cf.NewServiceProviderError(ErrorBadRequest, err)
+	}
+
+	// overrides of the instance are kept, so moving to another plan does not reset its replication
+	settings, err := keyspaceSettings(plan, updated)
+	if err != nil {
+		return cf.NewServiceProviderError(ErrorBadRequest, err)
+	}
 
-	query := "CREATE KEYSPACE " + keyspace +
-		" WITH replication = {'class': 'SimpleStrategy', 'replication_factor' : 3};"
-	err = service.session.Query(query).Exec()
+	parameters, err := marshalParameters(updated)
 	if err != nil {
-		panic(err.Error())
+		return serverError(err)
 	}
 
-	err = service.session.Query("INSERT INTO instances(id, keyspace_name, created_at) VALUES(?, ?, ?)",
-		r.InstanceID, keyspace, time.Now()).Exec()
+	err = service.ddlQuery("ALTER KEYSPACE " + keyspace + " WITH " + keyspaceOptions(settings)).Exec()
 	if err != nil {
-		panic(err.Error())
+		return serverError(err)
+	}
+
+	updatedRole, err := service.grantInstanceRole(r.InstanceID, keyspace, role)
+	if err != nil {
+		return serverError(err)
+	}
+
+	if plan.Id != planID {
+		err = service.regrantBindings(r.InstanceID, keyspace, role, updatedRole, plan)
+		if err != nil {
+			return serverError(err)
+		}
+	}
+
+	query = "UPDATE instances SET plan_id = ?, parameters = ? WHERE id = ?"
+	err = service.session.Query(query, plan.Id, parameters, r.InstanceID).Exec()
+	if err != nil {
+		return serverError(err)
 	}
 
 	return nil
 }
 
-// DeleteService deletes previously created service instance
-func (service *cassandraService) DeleteService(instanceID string) *cf.ServiceProviderError {
-	var err error
+// GetService returns service and plan of the service instance
+// and parameters it was provisioned with
+func (service *cassandraService) GetService(instanceID string) (*ServiceInstanceResponse, *cf.ServiceProviderError) {
+	var context, parameters, state string
+	response := new(ServiceInstanceResponse)
 
-	if !service.isInstanceExist(instanceID) {
-		return cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(instanceID))
+	query := "SELECT service_id, plan_id, organization_guid, space_guid, context, parameters, state FROM instances WHERE id = ?"
+	err := service.readQuery(query, instanceID).Scan(&response.ServiceID, &response.PlanID,
+		&response.OrganizationGUID, &response.SpaceGUID, &context, &parameters, &state)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, cf.NewServiceProviderError(ErrorNotFound, errors.New(instanceID))
+		}
+		return nil, serverError(err)
+	}
+
+	if state == stateCreating {
+		return nil, cf.NewServiceProviderError(ErrorNotFound, errors.New(instanceID))
 	}
 
-	keyspace, err := service.findKeyspaceNameByInstanceId(instanceID)
+	response.Context, err = unmarshalParameters(context)
 	if err != nil {
-		panic(err.Error())
+		return nil, serverError(err)
 	}
 
-	err = service.session.Query("DELETE FROM instances WHERE id=?", instanceID).Exec()
+	response.Parameters, err = unmarshalParameters(parameters)
 	if err != nil {
-		panic(err.Error())
+		return nil, serverError(err)
+	}
+
+	return response, nil
+}
+
+// DeleteService deletes previously created service instance,
+// leftovers of the failed provisioning are cleaned up as well
+func (service *cassandraService) DeleteService(instanceID string) *cf.ServiceProviderError {
+	keyspace, role, err := service.findInstanceAccess(instanceID)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(instanceID))
+		}
+		return serverError(err)
 	}
 
+	// the keyspace and the role are dropped first to keep the instance record for retries
 	err = service.dropKeyspaceIfExist(keyspace)
 	if err != nil {
-		panic(err.Error())
+		return serverError(err)
+	}
+
+	if roles, ok := service.dialect.(RoleDialect); ok && role != "" {
+		var permissionRoles []string
+		query := "SELECT permission_roles FROM instances WHERE id = ?"
+		err = service.readQuery(query, instanceID).Scan(&permissionRoles)
+		if err != nil {
+			return serverError(err)
+		}
+
+		for _, name := range append(permissionRoles, role) {
+			err = service.ddlQuery(roles.DropRole(name)).Exec()
+			if err != nil {
+				return serverError(err)
+			}
+		}
+	}
+
+	err = service.session.Query("DELETE FROM instances WHERE id=?", instanceID).Exec()
+	if err != nil {
+		return serverError(err)
 	}
 
 	return nil
@@ -96,43 +457,133 @@ func (service *cassandraService) DeleteService(instanceID string) *cf.ServicePro
 
 // BindService binds to specified service instance and
 // Returns credentials necessary to establish connection to that service
-func (service *cassandraService) BindService(r *cf.ServiceBindingRequest) (*ServiceBindingResponse, *cf.ServiceProviderError) {
-	var err error
-	var query string
-
-	if !service.isInstanceExist(r.InstanceID) {
+func (service *cassandraService) BindService(r *ServiceBindingRequest, plan *config.PlanConfig) (*ServiceBindingResponse, *cf.ServiceProviderError) {
+	var planID, state string
+	err := service.readQuery("SELECT plan_id, state FROM instances WHERE id = ?", r.InstanceID).Scan(&planID, &state)
+	if err != nil && err != gocql.ErrNotFound {
+		return nil, serverError(err)
+	}
+	if err == gocql.ErrNotFound || state == stateCreating {
 		return nil, cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(r.InstanceID))
 	}
 
-	if service.isBindingExist(r.BindingID) {
-		return nil, cf.NewServiceProviderError(cf.ErrorInstanceExists, errors.New(r.BindingID))
+	// the binding gets permissions and lifetime allowed by the plan of the instance
+	if planID != "" && planID != plan.Id {
+		return nil, cf.NewServiceProviderError(ErrorBadRequest,
+			fmt.Errorf("plan %s does not match plan %s of instance %s", plan.Id, planID, r.InstanceID))
+	}
+
+	parameters, err := marshalParameters(r.Parameters)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	grants, err := bindingPermissions(plan, r.Parameters)
+	if err != nil {
+		return nil, cf.NewServiceProviderError(ErrorBadRequest, err)
+	}
+
+	ttl, err := bindingTTL(plan, r.Parameters)
+	if err != nil {
+		return nil, cf.NewServiceProviderError(ErrorBadRequest, err)
+	}
+
+	tables, err := marshalTables(grants.Tables)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	context, err := marshalParameters(r.Context)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	keyspace, role, err := service.findInstanceAccess(r.InstanceID)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	if len(grants.Tables) > 0 {
+		missing, err := service.findMissingTables(keyspace, grants.tableNames())
+		if err != nil {
+			return nil, serverError(err)
+		}
+		if len(missing) > 0 {
+			return nil, cf.NewServiceProviderError(ErrorBadRequest,
+				fmt.Errorf("tables %s do not exist in keyspace %s", strings.Join(missing, ", "), keyspace))
+		}
+	}
+
+	err = service.reclaimBinding(r.BindingID)
+	if err != nil {
+		return nil, serverError(err)
 	}
 
 	username := "cf-" + random.Hex(10)
 	password := random.Hex(10)
-	keyspace, err := service.findKeyspaceNameByInstanceId(r.InstanceID)
+	createdAt := time.Now()
+	undo := new(rollback)
+
+	// the binding is registered before the user is created,
+	// so concurrent requests for the same binding never create two users
+	// and unbinding is able to find and drop the user if binding fails
+	existing := make(map[string]interface{})
+	applied, err := service.session.Query(`INSERT INTO
+		bindings(id, instance_id, service_id, plan_id, app_guid, route, context, parameters, permission_profile,
+			permissions, table_permissions, username, password, state, created_at, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS`,
+		r.BindingID, r.InstanceID, r.ServiceID, r.PlanID, r.AppGUID, r.BindResource.Route, context, parameters, grants.Profile,
+		strings.Join(grants.Permissions, ","), tables, username, password, stateCreating, createdAt,
+		expiresAt(ttl)).MapScanCAS(existing)
 	if err != nil {
-		panic(err.Error())
+		return nil, serverError(err)
 	}
 
-	query = fmt.Sprintf("CREATE USER '%s' WITH PASSWORD '%s' NOSUPERUSER", username, password)
-	err = service.session.Query(query).Exec()
+	if !applied {
+		if stringColumn(existing, "state") == stateCreating {
+			return nil, cf.NewServiceProviderError(ErrorConcurrency, errors.New(r.BindingID))
+		}
+		if stringColumn(existing, "state") == stateExpired {
+			return nil, cf.NewServiceProviderError(cf.ErrorInstanceExists, fmt.Errorf("binding %s has expired", r.BindingID))
+		}
+		if stringColumn(existing, "instance_id") != r.InstanceID || stringColumn(existing, "service_id") != r.ServiceID ||
+			stringColumn(existing, "plan_id") != r.PlanID || stringColumn(existing, "app_guid") != r.AppGUID ||
+			!equalParameters(stringColumn(existing, "parameters"), parameters) {
+			return nil, cf.NewServiceProviderError(cf.ErrorInstanceExists, errors.New(r.BindingID))
+		}
+
+		response := &ServiceBindingResponse{
+			Credentials: ServiceCredentials{
+				Username: stringColumn(existing, "username"),
+				Password: stringColumn(existing, "password"),
+				Keyspace: keyspace,
+			},
+			Exists: true,
+		}
+		return response, nil
+	}
+	undo.add("delete binding "+r.BindingID, func() error {
+		return service.deleteRecord("bindings", r.BindingID, createdAt)
+	})
+
+	// the user might have been created even though the request failed
+	undo.add("drop user "+username, func() error {
+		return service.dropUser(username)
+	})
+
+	err = service.ddlQuery(service.dialect.CreateLogin(username, password)).Exec()
 	if err != nil {
-		panic(err.Error())
+		return nil, serverError(undo.fail(err))
 	}
 
-	query = fmt.Sprintf("GRANT ALL PERMISSIONS on KEYSPACE %s TO '%s'", keyspace, username)
-	err = service.session.Query(query).Exec()
+	err = service.grantPermissions(r.InstanceID, keyspace, role, username, grants)
 	if err != nil {
-		panic(err.Error())
+		return nil, serverError(undo.fail(err))
 	}
 
-	err = service.session.Query(`INSERT INTO
-		bindings(id, instance_id, app_guid, username, password, created_at)
-		VALUES(?, ?, ?, ?, ?, ?)`,
-		r.BindingID, r.InstanceID, r.AppGUID, username, password, time.Now()).Exec()
+	err = service.finishRecord("bindings", r.BindingID, createdAt)
 	if err != nil {
-		panic(err.Error())
+		return nil, serverError(undo.fail(err))
 	}
 
 	response := &ServiceBindingResponse{
@@ -146,71 +597,590 @@ func (service *cassandraService) BindService(r *cf.ServiceBindingRequest) (*Serv
 	return response, nil
 }
 
-// UnbindService removes previously created binding
+// GetBinding returns credentials of previously created binding
+func (service *cassandraService) GetBinding(instanceID, bindingID string) (*ServiceBindingResponse, *cf.ServiceProviderError) {
+	var queriedInstanceId, parameters, state string
+	var expiration time.Time
+	response := new(ServiceBindingResponse)
+	creds := &response.Credentials
+
+	query := "SELECT instance_id, username, password, parameters, state, expires_at FROM bindings WHERE id = ?"
+	err := service.readQuery(query, bindingID).Scan(&queriedInstanceId, &creds.Username, &creds.Password,
+		&parameters, &state, &expiration)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, cf.NewServiceProviderError(ErrorNotFound, errors.New(bindingID))
+		}
+		return nil, serverError(err)
+	}
+
+	if queriedInstanceId != instanceID || state == stateCreating {
+		return nil, cf.NewServiceProviderError(ErrorNotFound, errors.New(bindingID))
+	}
+
+	if state == stateExpired {
+		return nil, cf.NewServiceProviderError(ErrorNotFound,
+			fmt.Errorf("binding %s has expired at %s", bindingID, expiration.UTC().Format(time.RFC3339)))
+	}
+
+	creds.Keyspace, err = service.findKeyspaceNameByInstanceId(instanceID)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	response.Parameters, err = unmarshalParameters(parameters)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	return response, nil
+}
+
+// UnbindService removes previously created binding,
+// leftovers of the failed binding are cleaned up as well
 func (service *cassandraService) UnbindService(instanceID, bindingID string) *cf.ServiceProviderError {
-	var err error
 	var queriedInstanceId string
 
-	if !service.isInstanceExist(instanceID) {
+	exists, err := service.isInstanceExist(instanceID)
+	if err != nil {
+		return serverError(err)
+	}
+	if !exists {
 		return cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(instanceID))
 	}
 
-	var username string
-	query := "SELECT username, instance_id FROM bindings WHERE id = ?"
-	err = service.session.Query(query, bindingID).Scan(&username, &queriedInstanceId)
+	var username, previousUsername string
+	query := "SELECT username, previous_username, instance_id FROM bindings WHERE id = ?"
+	err = service.readQuery(query, bindingID).Scan(&username, &previousUsername, &queriedInstanceId)
 	if err != nil {
 		if err == gocql.ErrNotFound {
 			return cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(bindingID))
-		} else {
-			panic(err.Error())
 		}
+		return serverError(err)
 	}
 
 	if queriedInstanceId != instanceID {
-		panic("wrong instance_id") // should never happen
+		return cf.NewServiceProviderError(cf.ErrorInstanceNotFound, errors.New(bindingID))
 	}
 
 	err = service.dropUser(username)
 	if err != nil {
-		panic(err.Error())
+		return serverError(err)
+	}
+
+	if previousUsername != "" {
+		err = service.dropUser(previousUsername)
+		if err != nil {
+			return serverError(err)
+		}
 	}
 
 	err = service.deleteBinding(bindingID)
 	if err != nil {
-		panic(err.Error())
+		return serverError(err)
+	}
+
+	return nil
+}
+
+// marshalParameters serializes request parameters to be stored in the broker keyspace
+func marshalParameters(parameters map[string]interface{}) (string, error) {
+	if len(parameters) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(parameters)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// equalParameters compares stored parameters with the marshaled ones of the request
+func equalParameters(stored, requested string) bool {
+	if stored == "null" || stored == "{}" {
+		stored = ""
+	}
+	return stored == requested
+}
+
+// marshalTables serializes table permissions of the binding to be stored in the broker keyspace
+func marshalTables(tables map[string][]string) (string, error) {
+	if tables == nil {
+		return "", nil
+	}
+
+	data, err := json.Marshal(tables)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func unmarshalParameters(data string) (map[string]interface{}, error) {
+	var parameters map[string]interface{}
+
+	if data == "" {
+		return nil, nil
+	}
+
+	err := json.Unmarshal([]byte(data), &parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	return parameters, nil
+}
+
+// stringColumn returns text column of the row returned by lightweight transaction
+func stringColumn(row map[string]interface{}, column string) string {
+	value, _ := row[column].(string)
+	return value
+}
+
+// keyspaceParameters are provisioning parameters overriding keyspace settings of the plan
+type keyspaceParameters struct {
+	ReplicationFactor *int           `json:"replication_factor"`
+	Datacenters       map[string]int `json:"datacenters"`
+	DurableWrites     *bool          `json:"durable_writes"`
+}
+
+// updatableParameters are provisioning parameters applied to existing keyspace by ALTER KEYSPACE
+var updatableParameters = map[string]bool{
+	"replication_factor": true,
+	"datacenters":        true,
+	"durable_writes":     true,
+}
+
+// mergeParameters overrides stored parameters of the instance with parameters of the update request,
+// changes of parameters which can't be applied to existing keyspace are refused
+func mergeParameters(stored, requested map[string]interface{}) (map[string]interface{}, error) {
+	merged := make(map[string]interface{}, len(stored)+len(requested))
+	for name, value := range stored {
+		merged[name] = value
+	}
+
+	for name, value := range requested {
+		if !updatableParameters[name] && !reflect.DeepEqual(stored[name], value) {
+			return nil, fmt.Errorf("parameter %q can not be updated", name)
+		}
+		merged[name] = value
+	}
+
+	// replication_factor and datacenters describe the same replication, so the requested one wins
+	if _, ok := requested["datacenters"]; ok {
+		if _, ok := requested["replication_factor"]; !ok {
+			delete(merged, "replication_factor")
+		}
+	} else if factor, ok := requested["replication_factor"]; ok {
+		if datacenters, ok := stored["datacenters"].(map[string]interface{}); ok {
+			scaled := make(map[string]interface{}, len(datacenters))
+			for datacenter := range datacenters {
+				scaled[datacenter] = factor
+			}
+			merged["datacenters"] = scaled
+		}
+	}
+
+	return merged, nil
+}
+
+// keyspaceSettings returns keyspace settings of the plan overridden by provisioning parameters
+func keyspaceSettings(plan *config.PlanConfig, parameters map[string]interface{}) (*config.KeyspaceConfig, error) {
+	settings := plan.Keyspace
+
+	if len(parameters) == 0 {
+		return &settings, nil
+	}
+
+	data, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrides keyspaceParameters
+	err = json.Unmarshal(data, &overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	// zero would select the default factor of the plan, so requests are refused instead
+	if overrides.ReplicationFactor != nil && *overrides.ReplicationFactor < 1 {
+		return nil, fmt.Errorf("replication_factor must be at least 1, got %d", *overrides.ReplicationFactor)
+	}
+	for datacenter, factor := range overrides.Datacenters {
+		if factor < 1 {
+			return nil, fmt.Errorf("replication factor of datacenter %q must be at least 1, got %d", datacenter, factor)
+		}
+	}
+
+	if overrides.Datacenters != nil {
+		settings.ReplicationClass = config.NetworkTopologyStrategy
+		settings.Datacenters = overrides.Datacenters
+	} else if overrides.ReplicationFactor != nil && settings.Class() == config.NetworkTopologyStrategy {
+		settings.Datacenters = make(map[string]int, len(plan.Keyspace.Datacenters))
+		for datacenter := range plan.Keyspace.Datacenters {
+			settings.Datacenters[datacenter] = *overrides.ReplicationFactor
+		}
+	}
+
+	if overrides.ReplicationFactor != nil {
+		settings.ReplicationFactor = *overrides.ReplicationFactor
+	}
+
+	if overrides.DurableWrites != nil {
+		settings.DurableWrites = overrides.DurableWrites
+	}
+
+	err = settings.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// keyspaceOptions returns replication and durable_writes options of CREATE/ALTER KEYSPACE statement
+func keyspaceOptions(settings *config.KeyspaceConfig) string {
+	replication := []string{fmt.Sprintf("'class': '%s'", settings.Class())}
+
+	if settings.Class() == config.NetworkTopologyStrategy {
+		datacenters := make([]string, 0, len(settings.Datacenters))
+		for datacenter := range settings.Datacenters {
+			datacenters = append(datacenters, datacenter)
+		}
+		sort.Strings(datacenters)
+
+		for _, datacenter := range datacenters {
+			replication = append(replication, fmt.Sprintf("'%s': %d", datacenter, settings.Datacenters[datacenter]))
+		}
+	} else {
+		replication = append(replication, fmt.Sprintf("'replication_factor': %d", settings.Factor()))
+	}
+
+	return fmt.Sprintf("replication = {%s} AND durable_writes = %t", strings.Join(replication, ", "), settings.Durable())
+}
+
+// isInstanceExist reports whether service instance has been completely provisioned
+func (service *cassandraService) isInstanceExist(instanceID string) (bool, error) {
+	var state string
+
+	query := "SELECT state FROM instances WHERE id = ?"
+	err := service.readQuery(query, instanceID).Scan(&state)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return state != stateCreating, nil
+}
+
+// instanceRole returns name of the role holding keyspace permissions of the instance,
+// empty if roles are not supported by the cluster
+func (service *cassandraService) instanceRole(keyspace string) string {
+	if _, ok := service.dialect.(RoleDialect); !ok {
+		return ""
+	}
+	return permissionRole(keyspace, []string{config.PermissionAll})
+}
+
+// grantPermissions grants keyspace permissions to the binding login,
+// on clusters supporting roles the login becomes a member of the instance roles holding them
+func (service *cassandraService) grantPermissions(instanceID, keyspace, ownerRole, username string, grants *bindingGrants) error {
+	roles, ok := service.dialect.(RoleDialect)
+
+	// bindings of instances provisioned before roles were introduced are granted directly
+	if !ok || ownerRole == "" {
+		return service.grantLogin(keyspace, username, grants)
+	}
+
+	var memberships []string
+
+	for _, table := range grants.tableNames() {
+		permissions := grants.Tables[table]
+		role := tableRole(keyspace, table, permissions)
+
+		statements := make([]string, len(permissions))
+		for i, permission := range permissions {
+			statements[i] = roles.GrantTable(keyspace, table, role, permission)
+		}
+
+		err := service.createPermissionRole(instanceID, role, statements)
+		if err != nil {
+			return err
+		}
+		memberships = append(memberships, role)
+	}
+
+	if len(grants.Permissions) > 0 {
+		role := permissionRole(keyspace, grants.Permissions)
+		if role != ownerRole {
+			statements := make([]string, len(grants.Permissions))
+			for i, permission := range grants.Permissions {
+				statements[i] = roles.GrantKeyspace(keyspace, role, permission)
+			}
+
+			err := service.createPermissionRole(instanceID, role, statements)
+			if err != nil {
+				return err
+			}
+		}
+		memberships = append(memberships, role)
+	}
+
+	for _, role := range memberships {
+		err := service.ddlQuery(roles.GrantRole(role, username)).Exec()
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (service *cassandraService) isInstanceExist(instanceID string) bool {
-	var recordsCount int
+// grantLogin grants keyspace and table permissions to the login itself
+func (service *cassandraService) grantLogin(keyspace, username string, grants *bindingGrants) error {
+	for _, table := range grants.tableNames() {
+		for _, permission := range grants.Tables[table] {
+			err := service.ddlQuery(service.dialect.GrantTable(keyspace, table, username, permission)).Exec()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, permission := range grants.Permissions {
+		err := service.ddlQuery(service.dialect.GrantKeyspace(keyspace, username, permission)).Exec()
+		if err != nil {
+			return err
+		}
+	}
 
-	query := "SELECT COUNT(*) FROM instances WHERE id = ?"
-	err := service.session.Query(query, instanceID).Scan(&recordsCount)
+	return nil
+}
+
+// createPermissionRole creates the instance role shared by bindings with the same permissions
+// and runs its grant statements, the role is recorded before it is created to be dropped along with the instance
+func (service *cassandraService) createPermissionRole(instanceID, role string, grants []string) error {
+	roles := service.dialect.(RoleDialect)
+
+	query := "UPDATE instances SET permission_roles = permission_roles + ? WHERE id = ?"
+	err := service.session.Query(query, []string{role}, instanceID).Exec()
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
 
-	return recordsCount > 0
+	err = service.ddlQuery(roles.CreateRole(role)).Exec()
+	if err != nil {
+		return err
+	}
+
+	for _, grant := range grants {
+		err = service.ddlQuery(grant).Exec()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// grantInstanceRole creates the owner role of the instance and grants it all keyspace permissions
+// and returns its name, instances provisioned before roles were introduced get the role recorded first,
+// it is safe to run again as the statements are idempotent
+func (service *cassandraService) grantInstanceRole(instanceID, keyspace, role string) (string, error) {
+	roles, ok := service.dialect.(RoleDialect)
+	if !ok {
+		return role, nil
+	}
+
+	if role == "" {
+		role = service.instanceRole(keyspace)
+		err := service.session.Query("UPDATE instances SET role_name = ? WHERE id = ?", role, instanceID).Exec()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err := service.ddlQuery(roles.CreateRole(role)).Exec()
+	if err != nil {
+		return "", err
+	}
+
+	return role, service.ddlQuery(roles.GrantKeyspace(keyspace, role, config.PermissionAll)).Exec()
+}
+
+// regrantBindings limits permissions of the instance bindings to the ones allowed for the plan the instance
+// has moved to. Logins of the changed bindings are granted the limited permissions through the instance role
+// and the permissions granted before through the previous role are revoked
+func (service *cassandraService) regrantBindings(instanceID, keyspace, previousRole, role string, plan *config.PlanConfig) error {
+	bindings, err := service.findRotationBindings(RotationScope{InstanceID: instanceID})
+	if err != nil {
+		return err
+	}
+
+	for _, binding := range bindings {
+		previous, err := storedGrants(binding.Permissions, binding.TablePermissions)
+		if err != nil {
+			return err
+		}
+
+		updated := restrictGrants(plan, previous)
+		if updated.equal(previous) {
+			continue
+		}
+
+		for _, username := range []string{binding.Username, binding.PreviousUsername} {
+			if username == "" {
+				continue
+			}
+
+			for _, statement := range revokeStatements(service.dialect, keyspace, previousRole, username, previous, updated) {
+				err = service.ddlQuery(statement).Exec()
+				if err != nil && !isNotGrantedError(err) {
+					return err
+				}
+			}
+
+			err = service.grantPermissions(instanceID, keyspace, role, username, updated)
+			if err != nil {
+				return err
+			}
+		}
+
+		tables, err := marshalTables(updated.Tables)
+		if err != nil {
+			return err
+		}
+
+		query := "UPDATE bindings SET permission_profile = ?, permissions = ?, table_permissions = ? WHERE id = ?"
+		err = service.session.Query(query, updated.Profile, strings.Join(updated.Permissions, ","), tables, binding.ID).Exec()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// errInvalid is the code of invalid request errors of the native protocol
+const errInvalid = 0x2200
+
+// isNotGrantedError reports whether revoking failed because the login is not a member of the role,
+// which happens if revoking is repeated after a failure
+func isNotGrantedError(err error) bool {
+	requestErr, ok := err.(gocql.RequestError)
+	return ok && requestErr.Code() == errInvalid && strings.Contains(requestErr.Message(), "is not a member of")
+}
+
+// reclaimInstance cleans up the instance left in creating state by failed broker,
+// so that it can be provisioned again
+func (service *cassandraService) reclaimInstance(instanceID string) error {
+	var keyspace, role, state string
+	var createdAt time.Time
+
+	query := "SELECT keyspace_name, role_name, state, created_at FROM instances WHERE id = ?"
+	err := service.readQuery(query, instanceID).Scan(&keyspace, &role, &state, &createdAt)
+	if err == gocql.ErrNotFound {
+		return nil
+	}
+	if err != nil || state != stateCreating || !isStale(createdAt) {
+		return err
+	}
+
+	claimedAt, claimed, err := service.claimRecord("instances", instanceID, createdAt)
+	if err != nil || !claimed {
+		return err
+	}
+	rollbackLogger.Printf("Reclaiming instance %s left in creating state at %s", instanceID, createdAt.UTC().Format(time.RFC3339))
+
+	err = service.dropKeyspaceIfExist(keyspace)
+	if err != nil {
+		return err
+	}
+
+	if roles, ok := service.dialect.(RoleDialect); ok && role != "" {
+		err = service.ddlQuery(roles.DropRole(role)).Exec()
+		if err != nil {
+			return err
+		}
+	}
+
+	return service.deleteRecord("instances", instanceID, claimedAt)
 }
 
-func (service *cassandraService) isBindingExist(bindingID string) bool {
-	var recordsCount int
+// reclaimBinding cleans up the binding left in creating state by failed broker,
+// so that it can be created again
+func (service *cassandraService) reclaimBinding(bindingID string) error {
+	var username, state string
+	var createdAt time.Time
+
+	query := "SELECT username, state, created_at FROM bindings WHERE id = ?"
+	err := service.readQuery(query, bindingID).Scan(&username, &state, &createdAt)
+	if err == gocql.ErrNotFound {
+		return nil
+	}
+	if err != nil || state != stateCreating || !isStale(createdAt) {
+		return err
+	}
+
+	claimedAt, claimed, err := service.claimRecord("bindings", bindingID, createdAt)
+	if err != nil || !claimed {
+		return err
+	}
+	rollbackLogger.Printf("Reclaiming binding %s left in creating state at %s", bindingID, createdAt.UTC().Format(time.RFC3339))
 
-	query := "SELECT COUNT(*) FROM bindings WHERE id = ?"
-	err := service.session.Query(query, bindingID).Scan(&recordsCount)
+	err = service.dropUser(username)
 	if err != nil {
-		panic(err.Error())
+		return err
+	}
+
+	return service.deleteRecord("bindings", bindingID, claimedAt)
+}
+
+// findMissingTables returns which of the tables do not exist in the keyspace
+func (service *cassandraService) findMissingTables(keyspace string, tables []string) ([]string, error) {
+	existing := make(map[string]bool)
+
+	var table string
+	query := "SELECT table_name FROM system_schema.tables WHERE keyspace_name = ?"
+	iter := service.session.Query(query, keyspace).Iter()
+	for iter.Scan(&table) {
+		existing[table] = true
 	}
+	err := iter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, table := range tables {
+		if !existing[table] {
+			missing = append(missing, table)
+		}
+	}
+	return missing, nil
+}
 
-	return recordsCount > 0
+// findInstanceAccess returns keyspace of the instance and the role holding its permissions
+func (service *cassandraService) findInstanceAccess(instanceID string) (string, string, error) {
+	var keyspace, role string
+	query := "SELECT keyspace_name, role_name FROM instances WHERE id = ?"
+	err := service.readQuery(query, instanceID).Scan(&keyspace, &role)
+	if err != nil {
+		return "", "", err
+	}
+	return keyspace, role, nil
 }
 
 func (service *cassandraService) findKeyspaceNameByInstanceId(instanceID string) (string, error) {
 	var keyspace string
 	query := "SELECT keyspace_name FROM instances WHERE id = ?"
-	err := service.session.Query(query, instanceID).Scan(&keyspace)
+	err := service.readQuery(query, instanceID).Scan(&keyspace)
 	if err != nil {
 		return "", err
 	}
@@ -218,29 +1188,86 @@ func (service *cassandraService) findKeyspaceNameByInstanceId(instanceID string)
 }
 
 func (service *cassandraService) dropUser(name string) error {
-	query := fmt.Sprintf("DROP USER '%s'", name)
-	err := service.session.Query(query).Exec()
+	err := service.ddlQuery(service.dialect.DropLogin(name)).Exec()
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (service *cassandraService) dropKeyspaceIfExist(keyspace string) error {
-	var err error
+// keyspaceName renders the keyspace name template for the instance,
+// names of existing keyspaces are skipped by trying another random suffix
+func (service *cassandraService) keyspaceName(r *ServiceCreationRequest, plan *config.PlanConfig) (string, error) {
+	nameTemplate := service.keyspaceNameTemplate
+	if nameTemplate == "" {
+		nameTemplate = config.DefaultKeyspaceNameTemplate
+	}
+
+	for attempt := 0; attempt < keyspaceNameAttempts; attempt++ {
+		keyspace, err := config.KeyspaceName(nameTemplate, config.KeyspaceNameData{
+			InstanceID:       r.InstanceID,
+			OrganizationGUID: r.OrganizationGUID,
+			SpaceGUID:        r.SpaceGUID,
+			PlanName:         plan.Name,
+			Random:           random.Hex(10),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		exists, err := service.isKeyspaceExist(keyspace)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return keyspace, nil
+		}
+	}
+
+	return "", fmt.Errorf("no free keyspace name for instance %s after %d attempts", r.InstanceID, keyspaceNameAttempts)
+}
+
+// readQuery returns query reading the broker keyspace with the read consistency
+func (service *cassandraService) readQuery(stmt string, values ...interface{}) *gocql.Query {
+	return withConsistency(service.session.Query(stmt, values...), service.consistency.Read)
+}
+
+// ddlQuery returns schema change or access control statement run with the DDL consistency
+func (service *cassandraService) ddlQuery(stmt string) *gocql.Query {
+	return withConsistency(service.session.Query(stmt), service.consistency.DDL)
+}
+
+// withConsistency overrides the session consistency of the query if the level is set
+func withConsistency(query *gocql.Query, level string) *gocql.Query {
+	if level == "" {
+		return query
+	}
+	return query.Consistency(gocql.ParseConsistency(level))
+}
+
+func (service *cassandraService) isKeyspaceExist(keyspace string) (bool, error) {
 	var count int
 
 	selectQ := "SELECT COUNT(*) FROM system_schema.keyspaces WHERE keyspace_name=?"
-	err = service.session.Query(selectQ, keyspace).Scan(&count)
+	err := service.session.Query(selectQ, keyspace).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (service *cassandraService) dropKeyspaceIfExist(keyspace string) error {
+	exists, err := service.isKeyspaceExist(keyspace)
 	if err != nil {
 		return err
 	}
 
-	if count == 0 {
+	if !exists {
 		return nil
 	}
 
-	query := service.session.Query("DROP KEYSPACE " + keyspace)
+	query := service.ddlQuery("DROP KEYSPACE " + keyspace)
 	query.RetryPolicy(&gocql.SimpleRetryPolicy{NumRetries: 3})
 	err = query.Exec()
 	if err != nil {
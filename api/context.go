@@ -0,0 +1,18 @@
+package api
+
+// contextString returns string value of the platform context object sent along with the request
+func contextString(context map[string]interface{}, key string) string {
+	value, _ := context[key].(string)
+	return value
+}
+
+// applyContext takes organization and space of the instance from the platform context
+// if the request does not set them, platforms other than Cloud Foundry only send the context
+func (r *ServiceCreationRequest) applyContext() {
+	if r.OrganizationGUID == "" {
+		r.OrganizationGUID = contextString(r.Context, "organization_guid")
+	}
+	if r.SpaceGUID == "" {
+		r.SpaceGUID = contextString(r.Context, "space_guid")
+	}
+}
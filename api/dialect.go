@@ -0,0 +1,192 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gocql/gocql"
+
+	"github.com/Altoros/cf-cassandra-broker/config"
+)
+
+// Dialect builds access control statements supported by the Cassandra cluster
+type Dialect interface {
+	// CreateLogin returns statement creating non superuser able to log in with password
+	CreateLogin(name, password string) string
+
+	// DropLogin returns statement dropping previously created login if it exists
+	DropLogin(name string) string
+
+	// AlterPassword returns statement changing password of the login
+	AlterPassword(name, password string) string
+
+	// GrantKeyspace returns statement granting permission on keyspace to the login or role
+	GrantKeyspace(keyspace, name, permission string) string
+
+	// GrantTable returns statement granting permission on table of the keyspace to the login or role
+	GrantTable(keyspace, table, name, permission string) string
+
+	// RevokeKeyspace returns statement revoking permission on keyspace from the login or role
+	RevokeKeyspace(keyspace, name, permission string) string
+
+	// RevokeTable returns statement revoking permission on table of the keyspace from the login or role
+	RevokeTable(keyspace, table, name, permission string) string
+}
+
+// RoleDialect is implemented by dialects of clusters supporting roles,
+// permissions granted to a role are inherited by its members
+type RoleDialect interface {
+	Dialect
+
+	// CreateRole returns statement creating role which is not able to log in
+	CreateRole(name string) string
+
+	// DropRole returns statement dropping previously created role if it exists
+	DropRole(name string) string
+
+	// GrantRole returns statement making member inherit permissions of the role
+	GrantRole(role, member string) string
+
+	// RevokeRole returns statement making member stop inheriting permissions of the role
+	RevokeRole(role, member string) string
+}
+
+// NewDialect returns dialect for the release version of Cassandra,
+// roles are used starting from Cassandra 2.2
+func NewDialect(releaseVersion string) (Dialect, error) {
+	var major, minor int
+
+	_, err := fmt.Sscanf(releaseVersion, "%d.%d", &major, &minor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Cassandra release version %q", releaseVersion)
+	}
+
+	if major > 2 || (major == 2 && minor >= 2) {
+		return roleDialect{}, nil
+	}
+	return legacyDialect{}, nil
+}
+
+// DetectDialect queries release version of the Cassandra node and returns dialect for it
+func DetectDialect(session *gocql.Session) (Dialect, error) {
+	var releaseVersion string
+
+	err := session.Query("SELECT release_version FROM system.local").Scan(&releaseVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect Cassandra version: %s", err.Error())
+	}
+
+	return NewDialect(releaseVersion)
+}
+
+// legacyDialect uses users of Cassandra before 2.2
+type legacyDialect struct{}
+
+func (legacyDialect) CreateLogin(name, password string) string {
+	return fmt.Sprintf("CREATE USER %s WITH PASSWORD %s NOSUPERUSER", quote(name), quote(password))
+}
+
+func (legacyDialect) DropLogin(name string) string {
+	return fmt.Sprintf("DROP USER IF EXISTS %s", quote(name))
+}
+
+func (legacyDialect) AlterPassword(name, password string) string {
+	return fmt.Sprintf("ALTER USER %s WITH PASSWORD %s", quote(name), quote(password))
+}
+
+func (legacyDialect) GrantKeyspace(keyspace, name, permission string) string {
+	return grantKeyspace(keyspace, quote(name), permission)
+}
+
+func (legacyDialect) GrantTable(keyspace, table, name, permission string) string {
+	return grantTable(keyspace, table, quote(name), permission)
+}
+
+func (legacyDialect) RevokeKeyspace(keyspace, name, permission string) string {
+	return revokeKeyspace(keyspace, quote(name), permission)
+}
+
+func (legacyDialect) RevokeTable(keyspace, table, name, permission string) string {
+	return revokeTable(keyspace, table, quote(name), permission)
+}
+
+// roleDialect uses roles of Cassandra 2.2 and newer
+type roleDialect struct{}
+
+func (roleDialect) CreateLogin(name, password string) string {
+	return fmt.Sprintf("CREATE ROLE %s WITH LOGIN = true AND PASSWORD = %s AND SUPERUSER = false",
+		quote(name), quote(password))
+}
+
+func (roleDialect) DropLogin(name string) string {
+	return fmt.Sprintf("DROP ROLE IF EXISTS %s", quote(name))
+}
+
+func (roleDialect) AlterPassword(name, password string) string {
+	return fmt.Sprintf("ALTER ROLE %s WITH PASSWORD = %s", quote(name), quote(password))
+}
+
+func (roleDialect) GrantKeyspace(keyspace, name, permission string) string {
+	return grantKeyspace(keyspace, quote(name), permission)
+}
+
+func (roleDialect) GrantTable(keyspace, table, name, permission string) string {
+	return grantTable(keyspace, table, quote(name), permission)
+}
+
+func (roleDialect) RevokeKeyspace(keyspace, name, permission string) string {
+	return revokeKeyspace(keyspace, quote(name), permission)
+}
+
+func (roleDialect) RevokeTable(keyspace, table, name, permission string) string {
+	return revokeTable(keyspace, table, quote(name), permission)
+}
+
+func (roleDialect) CreateRole(name string) string {
+	return fmt.Sprintf("CREATE ROLE IF NOT EXISTS %s WITH LOGIN = false AND SUPERUSER = false", quote(name))
+}
+
+func (roleDialect) DropRole(name string) string {
+	return fmt.Sprintf("DROP ROLE IF EXISTS %s", quote(name))
+}
+
+func (roleDialect) GrantRole(role, member string) string {
+	return fmt.Sprintf("GRANT %s TO %s", quote(role), quote(member))
+}
+
+func (roleDialect) RevokeRole(role, member string) string {
+	return fmt.Sprintf("REVOKE %s FROM %s", quote(role), quote(member))
+}
+
+func grantKeyspace(keyspace, grantee, permission string) string {
+	if permission == config.PermissionAll {
+		permission = "ALL PERMISSIONS"
+	}
+	return fmt.Sprintf("GRANT %s ON KEYSPACE %s TO %s", permission, keyspace, grantee)
+}
+
+func grantTable(keyspace, table, grantee, permission string) string {
+	if permission == config.PermissionAll {
+		permission = "ALL PERMISSIONS"
+	}
+	return fmt.Sprintf("GRANT %s ON TABLE %s.\"%s\" TO %s", permission, keyspace, table, grantee)
+}
+
+func revokeKeyspace(keyspace, grantee, permission string) string {
+	if permission == config.PermissionAll {
+		permission = "ALL PERMISSIONS"
+	}
+	return fmt.Sprintf("REVOKE %s ON KEYSPACE %s FROM %s", permission, keyspace, grantee)
+}
+
+func revokeTable(keyspace, table, grantee, permission string) string {
+	if permission == config.PermissionAll {
+		permission = "ALL PERMISSIONS"
+	}
+	return fmt.Sprintf("REVOKE %s ON TABLE %s.\"%s\" FROM %s", permission, keyspace, table, grantee)
+}
+
+// quote returns CQL string literal
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
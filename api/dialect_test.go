@@ -0,0 +1,93 @@
+package api_test
+
+import (
+	"github.com/Altoros/cf-cassandra-broker/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dialect", func() {
+	Context("Cassandra 2.1", func() {
+		var dialect api.Dialect
+
+		BeforeEach(func() {
+			var err error
+			dialect, err = api.NewDialect("2.1.19")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("creates users", func() {
+			Ω(dialect.CreateLogin("cf-user", "secret")).To(Equal("CREATE USER 'cf-user' WITH PASSWORD 'secret' NOSUPERUSER"))
+		})
+
+		It("drops users", func() {
+			Ω(dialect.DropLogin("cf-user")).To(Equal("DROP USER IF EXISTS 'cf-user'"))
+		})
+
+		It("changes passwords of users", func() {
+			Ω(dialect.AlterPassword("cf-user", "secret")).To(Equal("ALTER USER 'cf-user' WITH PASSWORD 'secret'"))
+		})
+
+		It("grants keyspace permissions", func() {
+			Ω(dialect.GrantKeyspace("cf1234", "cf-user", "ALL")).To(Equal("GRANT ALL PERMISSIONS ON KEYSPACE cf1234 TO 'cf-user'"))
+			Ω(dialect.GrantKeyspace("cf1234", "cf-user", "SELECT")).To(Equal("GRANT SELECT ON KEYSPACE cf1234 TO 'cf-user'"))
+		})
+
+		It("grants table permissions", func() {
+			Ω(dialect.GrantTable("cf1234", "events", "cf-user", "MODIFY")).To(Equal(`GRANT MODIFY ON TABLE cf1234."events" TO 'cf-user'`))
+		})
+
+		It("revokes keyspace and table permissions", func() {
+			Ω(dialect.RevokeKeyspace("cf1234", "cf-user", "ALL")).To(Equal("REVOKE ALL PERMISSIONS ON KEYSPACE cf1234 FROM 'cf-user'"))
+			Ω(dialect.RevokeTable("cf1234", "events", "cf-user", "MODIFY")).To(Equal(`REVOKE MODIFY ON TABLE cf1234."events" FROM 'cf-user'`))
+		})
+
+		It("does not support roles", func() {
+			_, ok := dialect.(api.RoleDialect)
+			Ω(ok).To(BeFalse())
+		})
+	})
+
+	Context("Cassandra 3.11", func() {
+		var dialect api.Dialect
+
+		BeforeEach(func() {
+			var err error
+			dialect, err = api.NewDialect("3.11.4")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("creates login roles", func() {
+			Ω(dialect.CreateLogin("cf-user", "it's")).To(Equal(
+				"CREATE ROLE 'cf-user' WITH LOGIN = true AND PASSWORD = 'it''s' AND SUPERUSER = false"))
+		})
+
+		It("drops roles", func() {
+			Ω(dialect.DropLogin("cf-user")).To(Equal("DROP ROLE IF EXISTS 'cf-user'"))
+		})
+
+		It("changes passwords of roles", func() {
+			Ω(dialect.AlterPassword("cf-user", "secret")).To(Equal("ALTER ROLE 'cf-user' WITH PASSWORD = 'secret'"))
+		})
+
+		It("grants roles to logins", func() {
+			roles, ok := dialect.(api.RoleDialect)
+			Ω(ok).To(BeTrue())
+			Ω(roles.CreateRole("cf1234_owner")).To(Equal("CREATE ROLE IF NOT EXISTS 'cf1234_owner' WITH LOGIN = false AND SUPERUSER = false"))
+			Ω(roles.GrantRole("cf1234_owner", "cf-user")).To(Equal("GRANT 'cf1234_owner' TO 'cf-user'"))
+			Ω(roles.RevokeRole("cf1234_owner", "cf-user")).To(Equal("REVOKE 'cf1234_owner' FROM 'cf-user'"))
+		})
+	})
+
+	It("uses roles starting from Cassandra 2.2", func() {
+		legacy, _ := api.NewDialect("2.1.0")
+		roles, _ := api.NewDialect("2.2.0")
+		Ω(roles).ShouldNot(Equal(legacy))
+	})
+
+	It("returns error for malformed version", func() {
+		_, err := api.NewDialect("unknown")
+		Ω(err).Should(HaveOccurred())
+	})
+})
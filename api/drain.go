@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-community/types-cf"
+)
+
+// Drain refuses mutating requests once the broker is shutting down
+// and keeps track of the operations still changing Cassandra
+type Drain struct {
+	mutex    sync.Mutex
+	draining bool
+	running  int
+	idle     chan struct{}
+}
+
+func NewDrain() *Drain {
+	return &Drain{idle: make(chan struct{})}
+}
+
+// ServeHTTP lets reading requests through and tracks mutating ones,
+// which are refused with ErrorServiceUnavailable while draining
+func (d *Drain) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if r.Method == "GET" || r.Method == "HEAD" {
+		next(rw, r)
+		return
+	}
+
+	if !d.Begin() {
+		writeError(rw, cf.NewServiceProviderError(ErrorServiceUnavailable, errors.New("broker is shutting down")))
+		return
+	}
+	defer d.Done()
+
+	next(rw, r)
+}
+
+// Begin registers an operation, it returns false if the broker is draining
+func (d *Drain) Begin() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.draining {
+		return false
+	}
+	d.running++
+	return true
+}
+
+// Done marks the operation registered by Begin as finished
+func (d *Drain) Done() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.running--
+	d.notifyIdle()
+}
+
+// Start makes the drain refuse new operations
+func (d *Drain) Start() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.draining = true
+	d.notifyIdle()
+}
+
+// Wait waits for operations running after Start to finish, it returns false on timeout
+func (d *Drain) Wait(timeout time.Duration) bool {
+	select {
+	case <-d.idle:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (d *Drain) notifyIdle() {
+	if !d.draining || d.running > 0 {
+		return
+	}
+
+	select {
+	case <-d.idle:
+	default:
+		close(d.idle)
+	}
+}
@@ -0,0 +1,94 @@
+package api_test
+
+import (
+	"github.com/Altoros/cf-cassandra-broker/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codegangsta/negroni"
+
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Drain", func() {
+	var drain *api.Drain
+	var handler *negroni.Negroni
+	var entered, release chan struct{}
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest(method, "/v2/service_instances/foobar", nil)
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		drain = api.NewDrain()
+		entered = make(chan struct{}, 1)
+		release = make(chan struct{})
+		handler = negroni.New(drain)
+		handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "PUT" {
+				entered <- struct{}{}
+				<-release
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+	})
+
+	It("lets requests through", func() {
+		close(release)
+		Ω(serve("PUT").Code).To(Equal(200))
+	})
+
+	Context("Draining", func() {
+		BeforeEach(func() {
+			drain.Start()
+		})
+
+		It("refuses mutating requests", func() {
+			recorder := serve("DELETE")
+			Ω(recorder.Code).To(Equal(503))
+			Ω(recorder.Header().Get("Retry-After")).To(Equal("30"))
+			Ω(recorder.Body.String()).To(ContainSubstring("broker is shutting down"))
+		})
+
+		It("lets reading requests through", func() {
+			Ω(serve("GET").Code).To(Equal(200))
+		})
+
+		It("refuses new operations", func() {
+			Ω(drain.Begin()).To(BeFalse())
+		})
+	})
+
+	Describe("Wait", func() {
+		It("waits for running requests", func() {
+			finished := make(chan struct{})
+			go func() {
+				serve("PUT")
+				close(finished)
+			}()
+			Eventually(entered).Should(Receive())
+
+			drain.Start()
+			Ω(drain.Wait(10 * time.Millisecond)).To(BeFalse())
+
+			close(release)
+			Ω(drain.Wait(time.Second)).To(BeTrue())
+			Eventually(finished).Should(BeClosed())
+		})
+
+		It("times out if operations keep running", func() {
+			Ω(drain.Begin()).To(BeTrue())
+			drain.Start()
+			Ω(drain.Wait(10 * time.Millisecond)).To(BeFalse())
+
+			drain.Done()
+			Ω(drain.Wait(time.Second)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Altoros/cf-cassandra-broker/random"
+	"github.com/cloudfoundry-community/types-cf"
+	"github.com/gocql/gocql"
+)
+
+const (
+	// ErrorBadRequest raised if request refers to missing resources of the instance
+	ErrorBadRequest = 400
+
+	// ErrorNotFound raised if instance or binding to fetch not found
+	ErrorNotFound = 404
+
+	// ErrorConcurrency raised if another operation on the same instance or binding is in progress
+	ErrorConcurrency = 422
+
+	// ErrorServiceUnavailable raised if cassandra is temporarily unavailable
+	ErrorServiceUnavailable = 503
+)
+
+// RetryAfter is suggested to the platform on ErrorServiceUnavailable
+const RetryAfter = 30 * time.Second
+
+// cassandra error codes of the native protocol worth retrying
+const (
+	cassandraUnavailable   = 0x1000
+	cassandraOverloaded    = 0x1001
+	cassandraBootstrapping = 0x1002
+	cassandraWriteTimeout  = 0x1100
+	cassandraReadTimeout   = 0x1200
+)
+
+func init() {
+	cf.GetServiceProviderErrorCodeName[ErrorBadRequest] = "ErrorBadRequest"
+	cf.GetServiceProviderErrorCode["ErrorBadRequest"] = ErrorBadRequest
+	cf.GetServiceProviderErrorCodeName[ErrorNotFound] = "ErrorNotFound"
+	cf.GetServiceProviderErrorCode["ErrorNotFound"] = ErrorNotFound
+	cf.GetServiceProviderErrorCodeName[ErrorConcurrency] = "ErrorConcurrency"
+	cf.GetServiceProviderErrorCode["ErrorConcurrency"] = ErrorConcurrency
+	cf.GetServiceProviderErrorCodeName[ErrorServiceUnavailable] = "ErrorServiceUnavailable"
+	cf.GetServiceProviderErrorCode["ErrorServiceUnavailable"] = ErrorServiceUnavailable
+}
+
+// ErrorResponse describes error response of the broker,
+// Error is machine readable error code defined by Broker API
+type ErrorResponse struct {
+	Error         string `json:"error,omitempty"`
+	Description   string `json:"description"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+var errorLogger = NewLogger()
+
+// serverError wraps error of the cassandra cluster into service provider error,
+// transient failures are reported as ErrorServiceUnavailable
+func serverError(err error) *cf.ServiceProviderError {
+	if isTransient(err) {
+		return cf.NewServiceProviderError(ErrorServiceUnavailable, err)
+	}
+	return cf.NewServiceProviderError(cf.ErrorServerException, err)
+}
+
+func isTransient(err error) bool {
+	switch err {
+	case gocql.ErrTimeoutNoResponse, gocql.ErrTooManyTimeouts, gocql.ErrConnectionClosed,
+		gocql.ErrNoConnections, gocql.ErrUnavailable, gocql.ErrSessionClosed:
+		return true
+	}
+
+	if requestErr, ok := err.(gocql.RequestError); ok {
+		switch requestErr.Code() {
+		case cassandraUnavailable, cassandraOverloaded, cassandraBootstrapping,
+			cassandraWriteTimeout, cassandraReadTimeout:
+			return true
+		}
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+func writeError(w http.ResponseWriter, err *cf.ServiceProviderError) {
+	if err.Code == ErrorConcurrency {
+		renderer.JSON(w, err.Code, ErrorResponse{
+			Error:       "ConcurrencyError",
+			Description: "Another operation for this service instance is in progress: " + err.String(),
+		})
+		return
+	}
+
+	if err.Code < 500 {
+		renderer.JSON(w, err.Code, cf.BrokerError{Description: err.String()})
+		return
+	}
+
+	correlationID := random.Hex(8)
+	errorLogger.Printf("Request failed, correlation id %s: %s", correlationID, err.String())
+
+	response := ErrorResponse{
+		Description:   fmt.Sprintf("%s (correlation id %s)", err.String(), correlationID),
+		CorrelationID: correlationID,
+	}
+
+	if err.Code == ErrorServiceUnavailable {
+		response.Error = "ServiceUnavailable"
+		w.Header().Set("Retry-After", strconv.Itoa(int(RetryAfter.Seconds())))
+	} else {
+		response.Error = "InternalServerError"
+	}
+
+	renderer.JSON(w, err.Code, response)
+}
+
+// Recovery turns panic of the handler into error response with correlation id
+type Recovery struct{}
+
+func NewRecovery() *Recovery {
+	return &Recovery{}
+}
+
+func (rec *Recovery) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	defer func() {
+		if err := recover(); err != nil {
+			writeError(rw, cf.NewServiceProviderError(cf.ErrorServerException, fmt.Errorf("%v", err)))
+		}
+	}()
+
+	next(rw, r)
+}
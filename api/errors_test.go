@@ -0,0 +1,37 @@
+package api_test
+
+import (
+	"github.com/Altoros/cf-cassandra-broker/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codegangsta/negroni"
+
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Recovery", func() {
+	var recorder *httptest.ResponseRecorder
+
+	BeforeEach(func() {
+		handler := negroni.New(api.NewRecovery())
+		handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("unexpected")
+		})
+
+		recorder = httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/v2/catalog", nil)
+		handler.ServeHTTP(recorder, request)
+	})
+
+	It("returns a status code of 500", func() {
+		Ω(recorder.Code).To(Equal(500))
+	})
+
+	It("returns json with the cause", func() {
+		Ω(recorder.Body.String()).To(ContainSubstring(`"error": "InternalServerError"`))
+		Ω(recorder.Body.String()).To(ContainSubstring("unexpected"))
+	})
+})
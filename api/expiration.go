@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Altoros/cf-cassandra-broker/config"
+)
+
+const (
+	AuditExpireBinding = "expire-binding"
+
+	// stateExpired marks binding whose logins have been dropped by the reaper
+	stateExpired = "expired"
+)
+
+// bindingTTLParameters are binding parameters limiting lifetime of the binding
+type bindingTTLParameters struct {
+	TTL string `json:"ttl"`
+}
+
+// bindingTTL returns lifetime of the binding requested by binding parameters and allowed for the plan,
+// bindings without ttl live as long as the plan allows, zero if the binding never expires
+func bindingTTL(plan *config.PlanConfig, parameters map[string]interface{}) (time.Duration, error) {
+	var requested bindingTTLParameters
+
+	if len(parameters) > 0 {
+		data, err := json.Marshal(parameters)
+		if err != nil {
+			return 0, err
+		}
+
+		err = json.Unmarshal(data, &requested)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if requested.TTL == "" {
+		return plan.MaxBindingTTL, nil
+	}
+
+	ttl, err := time.ParseDuration(requested.TTL)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid ttl %q", requested.TTL)
+	}
+
+	if plan.MaxBindingTTL > 0 && ttl > plan.MaxBindingTTL {
+		return 0, fmt.Errorf("ttl %s exceeds maximum %s of plan %q", ttl, plan.MaxBindingTTL, plan.Name)
+	}
+
+	return ttl, nil
+}
+
+// ReapExpiredBindings drops logins of the bindings whose lifetime is over and marks them expired
+func (service *cassandraService) ReapExpiredBindings() error {
+	var binding rotationBinding
+	var expiresAt time.Time
+	var state string
+
+	query := "SELECT id, instance_id, username, previous_username, expires_at, state FROM bindings"
+	iter := service.readQuery(query).Iter()
+	for iter.Scan(&binding.ID, &binding.InstanceID, &binding.Username, &binding.PreviousUsername, &expiresAt, &state) {
+		if state != stateReady || expiresAt.IsZero() || expiresAt.After(time.Now()) {
+			continue
+		}
+
+		err := service.expireBinding(binding)
+		result, details := AuditSucceeded, "expired at "+expiresAt.UTC().Format(time.RFC3339)
+		if err != nil {
+			result, details = AuditFailed, err.Error()
+		}
+		service.audit(binding, AuditExpireBinding, "reaper", result, details)
+	}
+
+	return iter.Close()
+}
+
+func (service *cassandraService) expireBinding(binding rotationBinding) error {
+	for _, username := range []string{binding.Username, binding.PreviousUsername} {
+		if username == "" {
+			continue
+		}
+		err := service.dropUser(username)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := "UPDATE bindings SET state = ? WHERE id = ? IF state = ?"
+	_, err := service.session.Query(query, stateExpired, binding.ID, stateReady).MapScanCAS(make(map[string]interface{}))
+	return err
+}
+
+// expiresAt returns expiration time of the binding created now, nil if it never expires
+func expiresAt(ttl time.Duration) *time.Time {
+	if ttl == 0 {
+		return nil
+	}
+	t := time.Now().Add(ttl)
+	return &t
+}
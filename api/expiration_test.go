@@ -0,0 +1,43 @@
+package api_test
+
+import (
+	"github.com/Altoros/cf-cassandra-broker/api"
+	"github.com/Altoros/cf-cassandra-broker/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+)
+
+var _ = Describe("BindingTTL", func() {
+	plan := &config.PlanConfig{Name: "free", MaxBindingTTL: 72 * time.Hour}
+
+	It("expires bindings without ttl after maximum of the plan", func() {
+		ttl, err := api.BindingTTL(plan, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ttl).To(Equal(72 * time.Hour))
+	})
+
+	It("never expires bindings without ttl of plans without maximum", func() {
+		ttl, err := api.BindingTTL(&config.PlanConfig{Name: "free"}, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ttl).To(BeZero())
+	})
+
+	It("returns requested ttl", func() {
+		ttl, err := api.BindingTTL(plan, map[string]interface{}{"ttl": "24h"})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ttl).To(Equal(24 * time.Hour))
+	})
+
+	It("refuses ttl exceeding maximum of the plan", func() {
+		_, err := api.BindingTTL(plan, map[string]interface{}{"ttl": "96h"})
+		Ω(err).Should(MatchError(`ttl 96h0m0s exceeds maximum 72h0m0s of plan "free"`))
+	})
+
+	It("refuses malformed ttl", func() {
+		_, err := api.BindingTTL(plan, map[string]interface{}{"ttl": "-1h"})
+		Ω(err).Should(MatchError(`invalid ttl "-1h"`))
+	})
+})
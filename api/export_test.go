@@ -0,0 +1,23 @@
+package api
+
+import "github.com/Altoros/cf-cassandra-broker/config"
+
+// internals exposed to the api_test package
+var (
+	MergeParameters  = mergeParameters
+	KeyspaceSettings = keyspaceSettings
+	KeyspaceOptions  = keyspaceOptions
+	PermissionRole   = permissionRole
+	TableRole        = tableRole
+	BindingTTL       = bindingTTL
+)
+
+// RegrantBinding returns profile and permissions the binding keeps after the instance moves to the plan
+// and statements revoking the other permissions from the login
+func RegrantBinding(dialect Dialect, plan *config.PlanConfig, keyspace, ownerRole, username string,
+	permissions []string, tables map[string][]string) (string, []string, map[string][]string, []string) {
+	previous := &bindingGrants{Permissions: permissions, Tables: tables}
+	updated := restrictGrants(plan, previous)
+	return updated.Profile, updated.Permissions, updated.Tables,
+		revokeStatements(dialect, keyspace, ownerRole, username, previous, updated)
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/cloudfoundry-community/types-cf"
+	"github.com/gocql/gocql"
+
+	"github.com/Altoros/cf-cassandra-broker/config"
+)
+
+// InstanceInventory describes who owns provisioned keyspaces
+type InstanceInventory interface {
+	// ListInstances returns all instances of the broker without their bindings
+	ListInstances() ([]InstanceRecord, *cf.ServiceProviderError)
+
+	// GetInstanceRecord returns the instance with its bindings
+	GetInstanceRecord(instanceID string) (*InstanceRecord, *cf.ServiceProviderError)
+}
+
+type InstanceRecord struct {
+	InstanceID       string                 `json:"instance_id"`
+	Keyspace         string                 `json:"keyspace"`
+	ServiceID        string                 `json:"service_id"`
+	PlanID           string                 `json:"plan_id"`
+	OrganizationGUID string                 `json:"organization_guid"`
+	SpaceGUID        string                 `json:"space_guid"`
+	Platform         string                 `json:"platform,omitempty"`
+	Context          map[string]interface{} `json:"context,omitempty"`
+	State            string                 `json:"state"`
+	CreatedAt        time.Time              `json:"created_at"`
+	Bindings         []BindingRecord        `json:"bindings,omitempty"`
+}
+
+type BindingRecord struct {
+	BindingID         string                 `json:"binding_id"`
+	AppGUID           string                 `json:"app_guid,omitempty"`
+	Route             string                 `json:"route,omitempty"`
+	Context           map[string]interface{} `json:"context,omitempty"`
+	Username          string                 `json:"username"`
+	PermissionProfile string                 `json:"permission_profile,omitempty"`
+	State             string                 `json:"state"`
+	CreatedAt         time.Time              `json:"created_at"`
+	ExpiresAt         *time.Time             `json:"expires_at,omitempty"`
+}
+
+// NewInstanceInventory returns inventory of instances stored in the broker keyspace
+func NewInstanceInventory(appConfig *config.Config, session *gocql.Session) InstanceInventory {
+	return newCassandraService(appConfig, session, nil)
+}
+
+const instanceRecordColumns = `id, keyspace_name, service_id, plan_id, organization_guid, space_guid, platform, context,
+	state, created_at`
+
+func (service *cassandraService) ListInstances() ([]InstanceRecord, *cf.ServiceProviderError) {
+	instances := []InstanceRecord{}
+
+	iter := service.readQuery("SELECT " + instanceRecordColumns + " FROM instances").Iter()
+	for {
+		instance, ok, err := scanInstanceRecord(iter)
+		if err != nil {
+			iter.Close()
+			return nil, serverError(err)
+		}
+		if !ok {
+			break
+		}
+		instances = append(instances, *instance)
+	}
+	err := iter.Close()
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].InstanceID < instances[j].InstanceID
+	})
+
+	return instances, nil
+}
+
+func (service *cassandraService) GetInstanceRecord(instanceID string) (*InstanceRecord, *cf.ServiceProviderError) {
+	iter := service.readQuery("SELECT "+instanceRecordColumns+" FROM instances WHERE id = ?", instanceID).Iter()
+	instance, ok, err := scanInstanceRecord(iter)
+	if err == nil {
+		err = iter.Close()
+	}
+	if err != nil {
+		return nil, serverError(err)
+	}
+	if !ok {
+		return nil, cf.NewServiceProviderError(ErrorNotFound, errors.New(instanceID))
+	}
+
+	instance.Bindings, err = service.findBindingRecords(instanceID)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	return instance, nil
+}
+
+// scanInstanceRecord scans the next instance of the iterator, ok is false once all are scanned
+func scanInstanceRecord(iter *gocql.Iter) (*InstanceRecord, bool, error) {
+	var instance InstanceRecord
+	var context string
+
+	if !iter.Scan(&instance.InstanceID, &instance.Keyspace, &instance.ServiceID, &instance.PlanID,
+		&instance.OrganizationGUID, &instance.SpaceGUID, &instance.Platform, &context, &instance.State,
+		&instance.CreatedAt) {
+		return nil, false, nil
+	}
+
+	if instance.State == "" {
+		instance.State = stateReady
+	}
+
+	var err error
+	instance.Context, err = unmarshalParameters(context)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &instance, true, nil
+}
+
+// findBindingRecords returns bindings of the instance sorted by id
+func (service *cassandraService) findBindingRecords(instanceID string) ([]BindingRecord, error) {
+	var bindings []BindingRecord
+	var binding BindingRecord
+	var context string
+	var expiresAt time.Time
+
+	query := `SELECT id, app_guid, route, context, username, permission_profile, state, created_at,
+		expires_at FROM bindings WHERE instance_id = ?`
+	iter := service.readQuery(query, instanceID).Iter()
+	for iter.Scan(&binding.BindingID, &binding.AppGUID, &binding.Route, &context,
+		&binding.Username, &binding.PermissionProfile, &binding.State, &binding.CreatedAt, &expiresAt) {
+		record := binding
+		if record.State == "" {
+			record.State = stateReady
+		}
+		if !expiresAt.IsZero() {
+			expiration := expiresAt
+			record.ExpiresAt = &expiration
+		}
+
+		var err error
+		record.Context, err = unmarshalParameters(context)
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+
+		bindings = append(bindings, record)
+	}
+	err := iter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(bindings, func(i, j int) bool {
+		return bindings[i].BindingID < bindings[j].BindingID
+	})
+
+	return bindings, nil
+}
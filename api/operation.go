@@ -0,0 +1,146 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/Altoros/cf-cassandra-broker/config"
+)
+
+const (
+	OperationProvision   = "provision"
+	OperationUpdate      = "update"
+	OperationDeprovision = "deprovision"
+
+	OperationInProgress = "in progress"
+	OperationSucceeded  = "succeeded"
+	OperationFailed     = "failed"
+
+	// operationTTL is how long operations are kept for last_operation polling
+	operationTTL = 7 * 24 * time.Hour
+)
+
+type Operation struct {
+	ID          string
+	InstanceID  string
+	Type        string
+	State       string
+	Description string
+}
+
+type OperationStore interface {
+	// CreateOperation persists a new in progress operation for service instance
+	CreateOperation(instanceID, operationType string) (*Operation, error)
+
+	// UpdateOperation persists state and description of the operation
+	UpdateOperation(operation *Operation) error
+
+	// FindOperation returns operation of service instance,
+	// the most recent one if operationID is empty
+	FindOperation(instanceID, operationID string) (*Operation, error)
+}
+
+type LastOperationResponse struct {
+	State       string `json:"state"`
+	Description string `json:"description,omitempty"`
+}
+
+type AsyncOperationResponse struct {
+	Operation string `json:"operation,omitempty"`
+}
+
+type cassandraOperationStore struct {
+	session     *gocql.Session
+	consistency config.ConsistencyConfig
+}
+
+// CreateOperation persists a new in progress operation for service instance
+func (store *cassandraOperationStore) CreateOperation(instanceID, operationType string) (*Operation, error) {
+	operation := &Operation{
+		ID:         gocql.TimeUUID().String(),
+		InstanceID: instanceID,
+		Type:       operationType,
+		State:      OperationInProgress,
+	}
+
+	now := time.Now()
+	query := store.session.Query(`INSERT INTO
+		operations(instance_id, id, type, state, description, created_at, updated_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?) USING TTL ?`,
+		operation.InstanceID, operation.ID, operation.Type, operation.State,
+		operation.Description, now, now, int(operationTTL.Seconds()))
+	err := withConsistency(query, store.consistency.Write).Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	return operation, nil
+}
+
+// UpdateOperation persists state and description of the operation
+func (store *cassandraOperationStore) UpdateOperation(operation *Operation) error {
+	query := store.session.Query(`UPDATE operations USING TTL ? SET state = ?, description = ?, updated_at = ?
+		WHERE instance_id = ? AND id = ?`, int(operationTTL.Seconds()),
+		operation.State, operation.Description, time.Now(), operation.InstanceID, operation.ID)
+	return withConsistency(query, store.consistency.Write).Exec()
+}
+
+// FailStaleOperations marks operations left in progress by failed broker as failed,
+// so that last_operation polling completes and the operation can be requested again
+func (store *cassandraOperationStore) FailStaleOperations() error {
+	var instanceID, state string
+	var id gocql.UUID
+	var createdAt time.Time
+
+	query := store.session.Query("SELECT instance_id, id, state, created_at FROM operations")
+	iter := withConsistency(query, store.consistency.Read).Iter()
+	for iter.Scan(&instanceID, &id, &state, &createdAt) {
+		if state != OperationInProgress || !isStale(createdAt) {
+			continue
+		}
+
+		// the operation completed meanwhile keeps its state
+		_, err := store.session.Query(`UPDATE operations USING TTL ? SET state = ?, description = ?, updated_at = ?
+			WHERE instance_id = ? AND id = ? IF state = ?`, int(operationTTL.Seconds()),
+			OperationFailed, "operation has not completed, the broker running it might have failed", time.Now(),
+			instanceID, id, OperationInProgress).MapScanCAS(make(map[string]interface{}))
+		if err != nil {
+			iter.Close()
+			return err
+		}
+	}
+
+	return iter.Close()
+}
+
+// FindOperation returns operation of service instance,
+// the most recent one if operationID is empty
+func (store *cassandraOperationStore) FindOperation(instanceID, operationID string) (*Operation, error) {
+	var query *gocql.Query
+
+	if operationID == "" {
+		query = store.session.Query(`SELECT id, type, state, description
+			FROM operations WHERE instance_id = ? LIMIT 1`, instanceID)
+	} else {
+		operationUUID, err := gocql.ParseUUID(operationID)
+		if err != nil {
+			return nil, nil
+		}
+		query = store.session.Query(`SELECT id, type, state, description
+			FROM operations WHERE instance_id = ? AND id = ?`, instanceID, operationUUID)
+	}
+
+	var id gocql.UUID
+	operation := &Operation{InstanceID: instanceID}
+	err := withConsistency(query, store.consistency.Read).Scan(&id, &operation.Type, &operation.State, &operation.Description)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	operation.ID = id.String()
+
+	return operation, nil
+}
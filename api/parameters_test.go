@@ -0,0 +1,115 @@
+package api_test
+
+import (
+	"github.com/Altoros/cf-cassandra-broker/api"
+	"github.com/Altoros/cf-cassandra-broker/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parameters", func() {
+	Describe("MergeParameters", func() {
+		stored := map[string]interface{}{"replication_factor": 2.0, "owner": "team-a"}
+
+		It("overrides stored keyspace parameters", func() {
+			merged, err := api.MergeParameters(stored, map[string]interface{}{"replication_factor": 3.0, "durable_writes": false})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(merged).To(Equal(map[string]interface{}{"replication_factor": 3.0, "durable_writes": false, "owner": "team-a"}))
+		})
+
+		It("keeps stored parameters sent unchanged", func() {
+			merged, err := api.MergeParameters(stored, map[string]interface{}{"owner": "team-a"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(merged).To(Equal(stored))
+		})
+
+		It("refuses changes of other parameters", func() {
+			_, err := api.MergeParameters(stored, map[string]interface{}{"owner": "team-b"})
+			Ω(err).Should(MatchError(`parameter "owner" can not be updated`))
+		})
+
+		It("replaces replication factor by requested datacenters", func() {
+			datacenters := map[string]interface{}{"dc1": 3.0}
+			merged, err := api.MergeParameters(stored, map[string]interface{}{"datacenters": datacenters})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(merged).To(Equal(map[string]interface{}{"datacenters": datacenters, "owner": "team-a"}))
+		})
+
+		It("applies requested replication factor to stored datacenters", func() {
+			stored := map[string]interface{}{"datacenters": map[string]interface{}{"dc1": 3.0, "dc2": 2.0}}
+			merged, err := api.MergeParameters(stored, map[string]interface{}{"replication_factor": 1.0})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(merged).To(Equal(map[string]interface{}{
+				"datacenters":        map[string]interface{}{"dc1": 1.0, "dc2": 1.0},
+				"replication_factor": 1.0,
+			}))
+		})
+	})
+
+	Describe("KeyspaceOptions", func() {
+		disabled := false
+
+		DescribeTable("builds replication and durable_writes options",
+			func(settings config.KeyspaceConfig, expected string) {
+				Ω(api.KeyspaceOptions(&settings)).To(Equal(expected))
+			},
+			Entry("SimpleStrategy by default", config.KeyspaceConfig{},
+				"replication = {'class': 'SimpleStrategy', 'replication_factor': 3} AND durable_writes = true"),
+			Entry("SimpleStrategy", config.KeyspaceConfig{ReplicationClass: config.SimpleStrategy, ReplicationFactor: 2},
+				"replication = {'class': 'SimpleStrategy', 'replication_factor': 2} AND durable_writes = true"),
+			Entry("NetworkTopologyStrategy with datacenters sorted",
+				config.KeyspaceConfig{
+					ReplicationClass: config.NetworkTopologyStrategy,
+					Datacenters:      map[string]int{"dc2": 2, "dc1": 3},
+				},
+				"replication = {'class': 'NetworkTopologyStrategy', 'dc1': 3, 'dc2': 2} AND durable_writes = true"),
+			Entry("durable_writes disabled", config.KeyspaceConfig{ReplicationFactor: 1, DurableWrites: &disabled},
+				"replication = {'class': 'SimpleStrategy', 'replication_factor': 1} AND durable_writes = false"),
+		)
+	})
+
+	Describe("KeyspaceSettings", func() {
+		simple := &config.PlanConfig{Name: "simple", Keyspace: config.KeyspaceConfig{ReplicationFactor: 2}}
+		multiDC := &config.PlanConfig{Name: "multi-dc", Keyspace: config.KeyspaceConfig{
+			ReplicationClass: config.NetworkTopologyStrategy,
+			Datacenters:      map[string]int{"dc1": 3, "dc2": 3},
+		}}
+
+		DescribeTable("overrides keyspace settings of the plan",
+			func(plan *config.PlanConfig, parameters map[string]interface{}, expected string) {
+				settings, err := api.KeyspaceSettings(plan, parameters)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(api.KeyspaceOptions(settings)).To(Equal(expected))
+			},
+			Entry("without parameters", simple, nil,
+				"replication = {'class': 'SimpleStrategy', 'replication_factor': 2} AND durable_writes = true"),
+			Entry("by replication_factor", simple, map[string]interface{}{"replication_factor": 5.0},
+				"replication = {'class': 'SimpleStrategy', 'replication_factor': 5} AND durable_writes = true"),
+			Entry("by replication_factor of every datacenter", multiDC, map[string]interface{}{"replication_factor": 2.0},
+				"replication = {'class': 'NetworkTopologyStrategy', 'dc1': 2, 'dc2': 2} AND durable_writes = true"),
+			Entry("by datacenters", simple, map[string]interface{}{"datacenters": map[string]interface{}{"east": 3.0}},
+				"replication = {'class': 'NetworkTopologyStrategy', 'east': 3} AND durable_writes = true"),
+			Entry("by durable_writes", multiDC, map[string]interface{}{"durable_writes": false},
+				"replication = {'class': 'NetworkTopologyStrategy', 'dc1': 3, 'dc2': 3} AND durable_writes = false"),
+			Entry("ignoring other parameters", simple, map[string]interface{}{"owner": "team-a"},
+				"replication = {'class': 'SimpleStrategy', 'replication_factor': 2} AND durable_writes = true"),
+		)
+
+		DescribeTable("refuses invalid parameters",
+			func(parameters map[string]interface{}, expected string) {
+				_, err := api.KeyspaceSettings(simple, parameters)
+				Ω(err).Should(MatchError(expected))
+			},
+			Entry("zero replication_factor", map[string]interface{}{"replication_factor": 0.0},
+				"replication_factor must be at least 1, got 0"),
+			Entry("negative replication_factor", map[string]interface{}{"replication_factor": -1.0},
+				"replication_factor must be at least 1, got -1"),
+			Entry("zero datacenter factor", map[string]interface{}{"datacenters": map[string]interface{}{"dc1": 0.0}},
+				`replication factor of datacenter "dc1" must be at least 1, got 0`),
+			Entry("invalid datacenter name", map[string]interface{}{"datacenters": map[string]interface{}{"dc 1": 3.0}},
+				`invalid datacenter name "dc 1"`),
+		)
+	})
+})
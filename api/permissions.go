@@ -0,0 +1,318 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Altoros/cf-cassandra-broker/config"
+)
+
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_]{1,48}$`)
+
+// bindingPermissionParameters are binding parameters selecting permissions of the binding
+type bindingPermissionParameters struct {
+	Role        string              `json:"role"`
+	Permissions []string            `json:"permissions"`
+	Tables      map[string][]string `json:"tables"`
+}
+
+// bindingGrants are permissions granted to the binding,
+// either on the whole keyspace or on the listed tables only
+type bindingGrants struct {
+	Profile     string
+	Permissions []string
+	Tables      map[string][]string
+}
+
+// bindingPermissions returns permissions requested by binding parameters and allowed for the plan
+func bindingPermissions(plan *config.PlanConfig, parameters map[string]interface{}) (*bindingGrants, error) {
+	var requested bindingPermissionParameters
+	allowed := plan.AllowedPermissionProfiles()
+
+	if len(parameters) > 0 {
+		data, err := json.Marshal(parameters)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(data, &requested)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if requested.Role != "" && requested.Permissions != nil {
+		return nil, errors.New("role and permissions can not be requested together")
+	}
+
+	if requested.Tables != nil {
+		if requested.Role != "" || requested.Permissions != nil {
+			return nil, errors.New("tables can not be requested together with role or permissions")
+		}
+		return tablePermissions(plan, requested.Tables)
+	}
+
+	if requested.Permissions != nil {
+		profile, permissions, err := customPermissions(plan, requested.Permissions)
+		if err != nil {
+			return nil, err
+		}
+		return &bindingGrants{Profile: profile, Permissions: permissions}, nil
+	}
+
+	profile := requested.Role
+	if profile == "" {
+		profile = allowed[0]
+	}
+
+	if !containsString(allowed, profile) {
+		return nil, fmt.Errorf("role %q is not allowed for plan %q, expected one of %s",
+			profile, plan.Name, strings.Join(allowed, ", "))
+	}
+
+	permissions, _ := config.ProfilePermissions(profile)
+	return &bindingGrants{Profile: profile, Permissions: permissions}, nil
+}
+
+// tablePermissions checks names of the tables and that their permissions are allowed for the plan
+func tablePermissions(plan *config.PlanConfig, requested map[string][]string) (*bindingGrants, error) {
+	if len(requested) == 0 {
+		return nil, errors.New("tables must not be empty")
+	}
+
+	tables := make(map[string][]string, len(requested))
+	for table, permissions := range requested {
+		if !tableNameRegexp.MatchString(table) {
+			return nil, fmt.Errorf("invalid table name %q", table)
+		}
+
+		_, permissions, err := customPermissions(plan, permissions)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %s", table, err.Error())
+		}
+		if containsString(permissions, "CREATE") {
+			return nil, fmt.Errorf("table %s: permission CREATE can not be granted on a table", table)
+		}
+
+		tables[table] = permissions
+	}
+
+	return &bindingGrants{Profile: config.CustomPermissionProfile, Tables: tables}, nil
+}
+
+// storedGrants restores permissions of the binding from the broker keyspace,
+// bindings created before permission profiles were introduced have all permissions
+func storedGrants(permissions, tablePermissions string) (*bindingGrants, error) {
+	grants := &bindingGrants{Profile: config.CustomPermissionProfile}
+
+	if tablePermissions != "" {
+		err := json.Unmarshal([]byte(tablePermissions), &grants.Tables)
+		if err != nil {
+			return nil, err
+		}
+		return grants, nil
+	}
+
+	if permissions == "" {
+		grants.Permissions = []string{config.PermissionAll}
+	} else {
+		grants.Permissions = strings.Split(permissions, ",")
+	}
+
+	return grants, nil
+}
+
+// tableNames returns sorted names of the tables the binding is granted permissions on
+func (grants *bindingGrants) tableNames() []string {
+	names := make([]string, 0, len(grants.Tables))
+	for table := range grants.Tables {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// equal reports whether both grants give the same permissions
+func (grants *bindingGrants) equal(other *bindingGrants) bool {
+	if !equalStrings(grants.Permissions, other.Permissions) || len(grants.Tables) != len(other.Tables) {
+		return false
+	}
+	for table, permissions := range grants.Tables {
+		if !equalStrings(permissions, other.Tables[table]) {
+			return false
+		}
+	}
+	return true
+}
+
+// restrictGrants limits permissions of the binding to the ones allowed for the plan,
+// tables left without permissions are dropped. Bindings left without any permission
+// get an empty list of tables, as empty keyspace permissions stand for all of them
+func restrictGrants(plan *config.PlanConfig, grants *bindingGrants) *bindingGrants {
+	allowed := allowedPermissions(plan)
+
+	if grants.Tables != nil {
+		restricted := &bindingGrants{Profile: config.CustomPermissionProfile, Tables: make(map[string][]string)}
+		for table, permissions := range grants.Tables {
+			if kept := intersectPermissions(permissions, allowed); len(kept) > 0 {
+				restricted.Tables[table] = kept
+			}
+		}
+		return restricted
+	}
+
+	restricted := &bindingGrants{
+		Profile:     config.CustomPermissionProfile,
+		Permissions: intersectPermissions(grants.Permissions, allowed),
+	}
+	if len(restricted.Permissions) == 0 {
+		return &bindingGrants{Profile: config.CustomPermissionProfile, Tables: make(map[string][]string)}
+	}
+	for _, profile := range plan.AllowedPermissionProfiles() {
+		permissions, _ := config.ProfilePermissions(profile)
+		if equalStrings(permissions, restricted.Permissions) {
+			restricted.Profile = profile
+			break
+		}
+	}
+	return restricted
+}
+
+// allowedPermissions returns keyspace permissions of all profiles allowed for the plan
+func allowedPermissions(plan *config.PlanConfig) []string {
+	var permissions []string
+	for _, profile := range plan.AllowedPermissionProfiles() {
+		granted, _ := config.ProfilePermissions(profile)
+		permissions = append(permissions, granted...)
+	}
+	normalized, _ := config.NormalizePermissions(permissions)
+	return normalized
+}
+
+// intersectPermissions returns sorted permissions present in both lists, ALL stands for every permission
+func intersectPermissions(permissions, allowed []string) []string {
+	if containsString(allowed, config.PermissionAll) {
+		return permissions
+	}
+	if containsString(permissions, config.PermissionAll) {
+		return allowed
+	}
+
+	kept := []string{}
+	for _, permission := range permissions {
+		if containsString(allowed, permission) {
+			kept = append(kept, permission)
+		}
+	}
+	return kept
+}
+
+// grantRoles returns names of the instance roles the binding is a member of
+func grantRoles(keyspace string, grants *bindingGrants) []string {
+	var roles []string
+	for _, table := range grants.tableNames() {
+		roles = append(roles, tableRole(keyspace, table, grants.Tables[table]))
+	}
+	if len(grants.Permissions) > 0 {
+		roles = append(roles, permissionRole(keyspace, grants.Permissions))
+	}
+	return roles
+}
+
+// revokeStatements returns statements taking the previous permissions of the binding away from the login.
+// Permissions granted directly are revoked completely and granted again afterwards,
+// memberships are revoked only from the roles the binding is not going to be a member of
+func revokeStatements(dialect Dialect, keyspace, ownerRole, username string, previous, updated *bindingGrants) []string {
+	var statements []string
+
+	roles, ok := dialect.(RoleDialect)
+	if !ok || ownerRole == "" {
+		for _, table := range previous.tableNames() {
+			for _, permission := range previous.Tables[table] {
+				statements = append(statements, dialect.RevokeTable(keyspace, table, username, permission))
+			}
+		}
+		for _, permission := range previous.Permissions {
+			statements = append(statements, dialect.RevokeKeyspace(keyspace, username, permission))
+		}
+		return statements
+	}
+
+	kept := grantRoles(keyspace, updated)
+	for _, role := range grantRoles(keyspace, previous) {
+		if !containsString(kept, role) {
+			statements = append(statements, roles.RevokeRole(role, username))
+		}
+	}
+	return statements
+}
+
+// customPermissions checks that requested permissions are covered by one of the profiles allowed for the plan
+func customPermissions(plan *config.PlanConfig, requested []string) (string, []string, error) {
+	permissions, err := config.NormalizePermissions(requested)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(permissions) == 0 {
+		return "", nil, errors.New("permissions must not be empty")
+	}
+
+	covered := false
+	for _, profile := range plan.AllowedPermissionProfiles() {
+		granted, _ := config.ProfilePermissions(profile)
+		if equalStrings(granted, permissions) {
+			return profile, permissions, nil
+		}
+		if containsString(granted, config.PermissionAll) || containsAll(granted, permissions) {
+			covered = true
+		}
+	}
+
+	if !covered {
+		return "", nil, fmt.Errorf("permissions %s are not allowed for plan %q",
+			strings.Join(permissions, ", "), plan.Name)
+	}
+
+	return config.CustomPermissionProfile, permissions, nil
+}
+
+// permissionRole returns name of the instance role holding given keyspace permissions,
+// the owner role holds all of them
+func permissionRole(keyspace string, permissions []string) string {
+	if len(permissions) == 1 && permissions[0] == config.PermissionAll {
+		return keyspace + "_owner"
+	}
+	return keyspace + "_" + strings.ToLower(strings.Join(permissions, "_"))
+}
+
+// tableRole returns name of the instance role holding given permissions on the table,
+// dots never appear in keyspace and table names, so the names do not clash with permission roles
+func tableRole(keyspace, table string, permissions []string) string {
+	return keyspace + "." + table + "." + strings.ToLower(strings.Join(permissions, "_"))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(values []string, subset []string) bool {
+	for _, v := range subset {
+		if !containsString(values, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	return len(a) == len(b) && containsAll(a, b)
+}
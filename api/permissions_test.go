@@ -0,0 +1,80 @@
+package api_test
+
+import (
+	"github.com/Altoros/cf-cassandra-broker/api"
+	"github.com/Altoros/cf-cassandra-broker/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Permission roles", func() {
+	It("names the owner role holding all permissions", func() {
+		Ω(api.PermissionRole("cf1234", []string{"ALL"})).To(Equal("cf1234_owner"))
+	})
+
+	It("names roles holding keyspace permissions", func() {
+		Ω(api.PermissionRole("cf1234", []string{"MODIFY", "SELECT"})).To(Equal("cf1234_modify_select"))
+	})
+
+	It("names roles holding table permissions", func() {
+		Ω(api.TableRole("cf1234", "events", []string{"MODIFY", "SELECT"})).To(Equal("cf1234.events.modify_select"))
+	})
+
+	It("does not clash table roles with keyspace roles", func() {
+		Ω(api.TableRole("cf1234", "alter", []string{"SELECT"})).ShouldNot(Equal(api.PermissionRole("cf1234", []string{"ALTER", "SELECT"})))
+		Ω(api.TableRole("cf1234", "a_modify", []string{"SELECT"})).ShouldNot(Equal(api.TableRole("cf1234", "a", []string{"MODIFY", "SELECT"})))
+	})
+})
+
+var _ = Describe("Plan change", func() {
+	var roles, legacy api.Dialect
+	readonly := &config.PlanConfig{Name: "readonly", PermissionProfiles: []string{"readonly"}}
+	readwrite := &config.PlanConfig{Name: "readwrite", PermissionProfiles: []string{"readwrite", "readonly"}}
+
+	BeforeEach(func() {
+		roles, _ = api.NewDialect("3.11.4")
+		legacy, _ = api.NewDialect("2.1.19")
+	})
+
+	It("moves bindings of the owner role to the role of permissions allowed by the plan", func() {
+		profile, permissions, tables, revokes := api.RegrantBinding(roles, readonly, "cf1234", "cf1234_owner", "cf-user",
+			[]string{"ALL"}, nil)
+		Ω(profile).To(Equal("readonly"))
+		Ω(permissions).To(Equal([]string{"SELECT"}))
+		Ω(tables).To(BeNil())
+		Ω(revokes).To(Equal([]string{"REVOKE 'cf1234_owner' FROM 'cf-user'"}))
+	})
+
+	It("keeps bindings with permissions allowed by the plan", func() {
+		profile, permissions, _, revokes := api.RegrantBinding(roles, readwrite, "cf1234", "cf1234_owner", "cf-user",
+			[]string{"SELECT"}, nil)
+		Ω(profile).To(Equal("readonly"))
+		Ω(permissions).To(Equal([]string{"SELECT"}))
+		Ω(revokes).To(BeEmpty())
+	})
+
+	It("revokes table permissions not allowed by the plan", func() {
+		_, _, tables, revokes := api.RegrantBinding(roles, readonly, "cf1234", "cf1234_owner", "cf-user", nil,
+			map[string][]string{"events": {"MODIFY"}, "devices": {"SELECT"}})
+		Ω(tables).To(Equal(map[string][]string{"devices": {"SELECT"}}))
+		Ω(revokes).To(Equal([]string{"REVOKE 'cf1234.events.modify' FROM 'cf-user'"}))
+	})
+
+	It("leaves bindings without permissions allowed by the plan without any", func() {
+		_, permissions, tables, revokes := api.RegrantBinding(roles, readonly, "cf1234", "cf1234_owner", "cf-user",
+			[]string{"CREATE"}, nil)
+		Ω(permissions).To(BeEmpty())
+		Ω(tables).To(BeEmpty())
+		Ω(tables).ShouldNot(BeNil())
+		Ω(revokes).To(Equal([]string{"REVOKE 'cf1234_create' FROM 'cf-user'"}))
+	})
+
+	It("revokes permissions granted directly to logins", func() {
+		profile, permissions, _, revokes := api.RegrantBinding(legacy, readwrite, "cf1234", "", "cf-user",
+			[]string{"ALL"}, nil)
+		Ω(profile).To(Equal("readwrite"))
+		Ω(permissions).To(Equal([]string{"MODIFY", "SELECT"}))
+		Ω(revokes).To(Equal([]string{"REVOKE ALL PERMISSIONS ON KEYSPACE cf1234 FROM 'cf-user'"}))
+	})
+})
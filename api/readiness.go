@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/cloudfoundry-community/types-cf"
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+
+	"github.com/Altoros/cf-cassandra-broker/config"
+)
+
+// Readiness tracks whether the broker has connected to Cassandra
+// and whether the session is still healthy
+type Readiness struct {
+	mutex    sync.RWMutex
+	ready    bool
+	attempts int
+	err      error
+	check    func() error
+}
+
+type ReadinessResponse struct {
+	Ready    bool   `json:"ready"`
+	Attempts int    `json:"failed_attempts,omitempty"`
+	Error    string `json:"last_error,omitempty"`
+}
+
+func NewReadiness() *Readiness {
+	return new(Readiness)
+}
+
+func (r *Readiness) Ready() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.ready
+}
+
+// SetReady marks the broker as connected, check is run on every readiness request
+// to report whether the session is still able to reach Cassandra
+func (r *Readiness) SetReady(check func() error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ready = true
+	r.err = nil
+	r.check = check
+}
+
+// SetFailed records failed connection attempt
+func (r *Readiness) SetFailed(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.attempts++
+	r.err = err
+}
+
+// ServeHTTP reports readiness to monitors, it responds 503 until the broker is connected
+// and while the session fails to reach Cassandra
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.RLock()
+	response := ReadinessResponse{Ready: r.ready, Attempts: r.attempts}
+	if r.err != nil {
+		response.Error = r.err.Error()
+	}
+	check := r.check
+	r.mutex.RUnlock()
+
+	if response.Ready && check != nil {
+		if err := check(); err != nil {
+			response.Ready = false
+			response.Error = err.Error()
+		}
+	}
+
+	status := http.StatusOK
+	if !response.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	renderer.JSON(w, status, response)
+}
+
+// NewDegraded returns handler used until Cassandra is reachable, it serves the catalog
+// and refuses other requests with ErrorServiceUnavailable
+func NewDegraded(appConfig *config.Config) http.Handler {
+	apiHandler := new(ApiHandler)
+	apiHandler.Config = appConfig
+
+	apiLogger := NewLogger()
+	apiHandler.Handler = negroni.New(apiLogger, NewRecovery(), NewVersionNegotiator())
+	apiHandler.Logger = apiLogger
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v2/catalog", apiHandler.ShowCatalog).Methods("GET")
+	router.NotFoundHandler = http.HandlerFunc(NotConnected)
+	apiHandler.Handler.UseHandler(router)
+
+	return apiHandler
+}
+
+// NotConnected refuses the request until the broker is connected to Cassandra
+func NotConnected(w http.ResponseWriter, r *http.Request) {
+	writeError(w, cf.NewServiceProviderError(ErrorServiceUnavailable, errors.New("broker is not connected to Cassandra yet")))
+}
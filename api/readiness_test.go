@@ -0,0 +1,118 @@
+package api_test
+
+import (
+	"github.com/Altoros/cf-cassandra-broker/api"
+	"github.com/Altoros/cf-cassandra-broker/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Readiness", func() {
+	var readiness *api.Readiness
+
+	serve := func() (*httptest.ResponseRecorder, api.ReadinessResponse) {
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/ready", nil)
+		readiness.ServeHTTP(recorder, request)
+
+		var response api.ReadinessResponse
+		Ω(json.Unmarshal(recorder.Body.Bytes(), &response)).Should(Succeed())
+		return recorder, response
+	}
+
+	BeforeEach(func() {
+		readiness = api.NewReadiness()
+	})
+
+	It("is not ready until connected", func() {
+		recorder, response := serve()
+		Ω(readiness.Ready()).To(BeFalse())
+		Ω(recorder.Code).To(Equal(503))
+		Ω(response.Ready).To(BeFalse())
+	})
+
+	It("reports failed connection attempts", func() {
+		readiness.SetFailed(errors.New("no hosts available"))
+		readiness.SetFailed(errors.New("connection refused"))
+
+		recorder, response := serve()
+		Ω(recorder.Code).To(Equal(503))
+		Ω(response.Attempts).To(Equal(2))
+		Ω(response.Error).To(Equal("connection refused"))
+	})
+
+	It("is ready once connected", func() {
+		readiness.SetFailed(errors.New("connection refused"))
+		readiness.SetReady(func() error { return nil })
+
+		recorder, response := serve()
+		Ω(readiness.Ready()).To(BeTrue())
+		Ω(recorder.Code).To(Equal(200))
+		Ω(response.Ready).To(BeTrue())
+		Ω(response.Error).To(BeEmpty())
+	})
+
+	It("is not ready while the session fails", func() {
+		healthy := false
+		readiness.SetReady(func() error {
+			if !healthy {
+				return errors.New("no hosts available in the pool")
+			}
+			return nil
+		})
+
+		recorder, response := serve()
+		Ω(recorder.Code).To(Equal(503))
+		Ω(response.Ready).To(BeFalse())
+		Ω(response.Error).To(Equal("no hosts available in the pool"))
+
+		healthy = true
+		recorder, _ = serve()
+		Ω(recorder.Code).To(Equal(200))
+	})
+})
+
+var _ = Describe("Degraded", func() {
+	var handler http.Handler
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest(method, path, nil)
+		request.Header.Set(api.VersionHeader, "2.13")
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		appConfig := &config.Config{}
+		appConfig.Catalog = config.CatalogConfig{
+			Services: []config.ServiceConfig{config.ServiceConfig{Id: "service-id", Name: "cassandra"}},
+		}
+		Ω(appConfig.Catalog.Index()).Should(Succeed())
+		handler = api.NewDegraded(appConfig)
+	})
+
+	It("serves the catalog", func() {
+		recorder := serve("GET", "/v2/catalog")
+		Ω(recorder.Code).To(Equal(200))
+		Ω(recorder.Body.String()).To(ContainSubstring("service-id"))
+	})
+
+	It("refuses provisioning with retry after", func() {
+		recorder := serve("PUT", "/v2/service_instances/foobar")
+		Ω(recorder.Code).To(Equal(503))
+		Ω(recorder.Header().Get("Retry-After")).To(Equal("30"))
+		Ω(recorder.Body.String()).To(ContainSubstring("not connected to Cassandra"))
+	})
+
+	It("refuses reading instances", func() {
+		recorder := serve("GET", "/v2/service_instances/foobar/last_operation")
+		Ω(recorder.Code).To(Equal(503))
+	})
+})
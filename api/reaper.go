@@ -0,0 +1,103 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/Altoros/cf-cassandra-broker/config"
+)
+
+// ReapInterval is how often the reaper runs its tasks
+const ReapInterval = time.Minute
+
+// Reaper periodically runs background cleanup tasks of the broker
+type Reaper struct {
+	Interval time.Duration
+	Logger   *Logger
+
+	tasks []reaperTask
+	mutex sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+type reaperTask struct {
+	name string
+	run  func() error
+}
+
+// NewReaper returns reaper of the cleanup tasks enabled by the config
+func NewReaper(appConfig *config.Config, session *gocql.Session, dialect Dialect) *Reaper {
+	service := newCassandraService(appConfig, session, dialect)
+	operations := &cassandraOperationStore{session: session, consistency: appConfig.Cassandra.Consistency}
+	reaper := &Reaper{Interval: ReapInterval, Logger: NewLogger()}
+
+	// the tasks run once the reaper starts, so operations of the broker failed before are completed on startup
+	reaper.AddTask("fail stale operations", operations.FailStaleOperations)
+	reaper.AddTask("expire bindings", service.ReapExpiredBindings)
+	if appConfig.Rotation.Mode == config.RotationDual {
+		reaper.AddTask("drop previous credentials", service.ReapPreviousCredentials)
+	}
+
+	return reaper
+}
+
+// AddTask registers task run by the reaper, it must be called before Start
+func (r *Reaper) AddTask(name string, run func() error) {
+	r.tasks = append(r.tasks, reaperTask{name: name, run: run})
+}
+
+// Start runs the tasks in background every interval
+func (r *Reaper) Start() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	r.stop, r.done = stop, done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+
+		for {
+			r.runTasks()
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the running tasks to complete and stops the reaper
+func (r *Reaper) Stop() {
+	r.mutex.Lock()
+	stop, done := r.stop, r.done
+	r.stop, r.done = nil, nil
+	r.mutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (r *Reaper) runTasks() {
+	for _, task := range r.tasks {
+		err := task.run()
+		if err != nil {
+			r.Logger.Printf("Reaper failed to %s: %s", task.name, err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package api_test
+
+import (
+	"github.com/Altoros/cf-cassandra-broker/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var _ = Describe("Reaper", func() {
+	var reaper *api.Reaper
+	var runs int32
+
+	BeforeEach(func() {
+		runs = 0
+		reaper = &api.Reaper{Interval: 10 * time.Millisecond, Logger: api.NewLogger()}
+		reaper.AddTask("fail", func() error {
+			return errors.New("unavailable")
+		})
+		reaper.AddTask("count", func() error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		})
+	})
+
+	AfterEach(func() {
+		reaper.Stop()
+	})
+
+	It("runs tasks periodically even if some of them fail", func() {
+		reaper.Start()
+		Eventually(func() int32 { return atomic.LoadInt32(&runs) }).Should(BeNumerically(">=", 3))
+	})
+
+	It("does not run tasks once stopped", func() {
+		reaper.Start()
+		Eventually(func() int32 { return atomic.LoadInt32(&runs) }).Should(BeNumerically(">=", 1))
+		reaper.Stop()
+
+		stopped := atomic.LoadInt32(&runs)
+		Consistently(func() int32 { return atomic.LoadInt32(&runs) }, 50*time.Millisecond).Should(Equal(stopped))
+	})
+})
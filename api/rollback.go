@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// stateCreating marks instance or binding whose provisioning has not completed yet,
+	// records left in this state by failed broker are reclaimed by the next request once stale
+	stateCreating = "creating"
+
+	// stateReady marks completely provisioned instance or binding
+	stateReady = "ready"
+
+	// staleCreatingAfter is how long a record may stay in creating state before
+	// it is considered left behind by failed broker and reclaimed by the next request
+	staleCreatingAfter = 10 * time.Minute
+)
+
+var rollbackLogger = NewLogger()
+
+// rollback collects undo steps of multi-step operation
+type rollback struct {
+	steps []rollbackStep
+}
+
+type rollbackStep struct {
+	description string
+	undo        func() error
+}
+
+// add records completed step of the operation along with the way to undo it
+func (r *rollback) add(description string, undo func() error) {
+	r.steps = append(r.steps, rollbackStep{description, undo})
+}
+
+// run undoes completed steps in reverse order, it stops on the first failure
+// to keep the progress record for a later cleanup by deprovisioning or unbinding
+func (r *rollback) run() error {
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		step := r.steps[i]
+		err := step.undo()
+		if err != nil {
+			err = fmt.Errorf("failed to %s: %s", step.description, err.Error())
+			rollbackLogger.Printf("Rollback failed: %s", err)
+			return err
+		}
+	}
+	r.steps = nil
+	return nil
+}
+
+// fail rolls completed steps back and returns the error which caused the failure
+func (r *rollback) fail(err error) error {
+	r.run()
+	return err
+}
+
+// isStale reports whether the record in creating state has been left behind by failed broker
+func isStale(createdAt time.Time) bool {
+	return time.Since(createdAt) > staleCreatingAfter
+}
+
+// claimRecord takes over the stale record in creating state by refreshing its creation time,
+// so concurrent requests do not reclaim it twice, it returns false if another request claimed it first
+func (service *cassandraService) claimRecord(table, id string, createdAt time.Time) (time.Time, bool, error) {
+	claimedAt := time.Now()
+	query := "UPDATE " + table + " SET created_at = ? WHERE id = ? IF state = ? AND created_at = ?"
+	applied, err := service.session.Query(query, claimedAt, id, stateCreating, createdAt).MapScanCAS(make(map[string]interface{}))
+	return claimedAt, applied, err
+}
+
+// finishRecord marks the record registered at the creation time as ready,
+// it fails if the record has been reclaimed meanwhile
+func (service *cassandraService) finishRecord(table, id string, createdAt time.Time) error {
+	query := "UPDATE " + table + " SET state = ? WHERE id = ? IF state = ? AND created_at = ?"
+	applied, err := service.session.Query(query, stateReady, id, stateCreating, createdAt).MapScanCAS(make(map[string]interface{}))
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return fmt.Errorf("%s record %s has been reclaimed by another request", table, id)
+	}
+	return nil
+}
+
+// deleteRecord deletes the record registered at the creation time unless it has been reclaimed meanwhile
+func (service *cassandraService) deleteRecord(table, id string, createdAt time.Time) error {
+	query := "DELETE FROM " + table + " WHERE id = ? IF state = ? AND created_at = ?"
+	_, err := service.session.Query(query, id, stateCreating, createdAt).MapScanCAS(make(map[string]interface{}))
+	return err
+}
@@ -0,0 +1,332 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-community/types-cf"
+	"github.com/gocql/gocql"
+
+	"github.com/Altoros/cf-cassandra-broker/config"
+	"github.com/Altoros/cf-cassandra-broker/random"
+)
+
+const (
+	AuditRotateCredentials       = "rotate-credentials"
+	AuditDropPreviousCredentials = "drop-previous-credentials"
+
+	AuditSucceeded = "succeeded"
+	AuditFailed    = "failed"
+)
+
+// CredentialRotator changes passwords of existing bindings
+type CredentialRotator interface {
+	// RotateCredentials rotates passwords of the bindings matched by the scope,
+	// actor is recorded in the audit log
+	RotateCredentials(scope RotationScope, actor string) (*RotationResponse, *cf.ServiceProviderError)
+}
+
+// RotationScope selects bindings to rotate credentials of,
+// all bindings of the broker are selected if it is empty
+type RotationScope struct {
+	InstanceID string
+	BindingID  string
+}
+
+// RotationResponse reports rotated bindings and applications to restage
+// to pick up new credentials
+type RotationResponse struct {
+	Bindings    []RotatedBinding `json:"bindings"`
+	RestageApps []string         `json:"restage_apps"`
+}
+
+type RotatedBinding struct {
+	BindingID  string `json:"binding_id"`
+	InstanceID string `json:"instance_id"`
+	AppGUID    string `json:"app_guid,omitempty"`
+	Error      string `json:"error,omitempty"`
+
+	// PreviousExpiresAt is set if the previous credentials keep working until then
+	PreviousExpiresAt *time.Time `json:"previous_credentials_expire_at,omitempty"`
+}
+
+// rotationBinding is a binding whose credentials are going to be rotated
+type rotationBinding struct {
+	ID               string
+	InstanceID       string
+	AppGUID          string
+	Username         string
+	PreviousUsername string
+	Permissions      string
+	TablePermissions string
+
+	// PreviousExpiresAt is the end of the grace period of the previous login
+	PreviousExpiresAt time.Time
+}
+
+var auditLogger = NewLogger()
+
+// NewCredentialRotator returns rotator of credentials stored in the broker keyspace
+func NewCredentialRotator(appConfig *config.Config, session *gocql.Session, dialect Dialect) CredentialRotator {
+	return newCassandraService(appConfig, session, dialect)
+}
+
+// RotateCredentials rotates passwords of the bindings matched by the scope,
+// it is safe to run again for bindings which failed to rotate
+func (service *cassandraService) RotateCredentials(scope RotationScope, actor string) (*RotationResponse, *cf.ServiceProviderError) {
+	bindings, err := service.findRotationBindings(scope)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	if scope.BindingID != "" && len(bindings) == 0 {
+		return nil, cf.NewServiceProviderError(ErrorNotFound, errors.New(scope.BindingID))
+	}
+
+	response := &RotationResponse{Bindings: []RotatedBinding{}, RestageApps: []string{}}
+	apps := make(map[string]bool)
+
+	for _, binding := range bindings {
+		rotated := RotatedBinding{BindingID: binding.ID, InstanceID: binding.InstanceID, AppGUID: binding.AppGUID}
+
+		var err error
+		if service.rotation.Mode == config.RotationDual {
+			rotated.PreviousExpiresAt, err = service.rotateLogin(binding)
+		} else {
+			err = service.rotatePassword(binding)
+		}
+
+		result := AuditSucceeded
+		if err != nil {
+			rotated.Error = err.Error()
+			result = AuditFailed
+		} else if binding.AppGUID != "" {
+			apps[binding.AppGUID] = true
+		}
+
+		service.audit(binding, AuditRotateCredentials, actor, result, rotated.Error)
+		response.Bindings = append(response.Bindings, rotated)
+	}
+
+	for app := range apps {
+		response.RestageApps = append(response.RestageApps, app)
+	}
+	sort.Strings(response.RestageApps)
+
+	return response, nil
+}
+
+// rotatePassword sets a new password of the binding login,
+// the password is stored once the login has been altered
+func (service *cassandraService) rotatePassword(binding rotationBinding) error {
+	password := random.Hex(10)
+
+	err := service.ddlQuery(service.dialect.AlterPassword(binding.Username, password)).Exec()
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE bindings SET password = ?, rotated_at = ? WHERE id = ?"
+	return service.session.Query(query, password, time.Now(), binding.ID).Exec()
+}
+
+// rotateLogin switches the binding to its alternate login with a new password,
+// the previous login is dropped by the reaper once the grace period is over.
+// The binding can't be rotated while its previous login is in the grace period,
+// since that login is the alternate one and applications may still use it
+func (service *cassandraService) rotateLogin(binding rotationBinding) (*time.Time, error) {
+	if binding.PreviousUsername != "" && binding.PreviousExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("previous login %s is in its grace period until %s",
+			binding.PreviousUsername, binding.PreviousExpiresAt.UTC().Format(time.RFC3339))
+	}
+
+	if binding.PreviousUsername != "" {
+		// the grace period is over but the reaper has not dropped the login yet
+		dropped, err := service.dropPreviousLogin(binding)
+		if err != nil {
+			return nil, err
+		}
+		if !dropped {
+			return nil, errors.New("binding has been rotated concurrently")
+		}
+	}
+
+	keyspace, role, err := service.findInstanceAccess(binding.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := storedGrants(binding.Permissions, binding.TablePermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	username := alternateUsername(binding.Username)
+	password := random.Hex(10)
+
+	// the alternate login might be a leftover of the rotation failed before or an expired previous login
+	err = service.dropUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.ddlQuery(service.dialect.CreateLogin(username, password)).Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.grantPermissions(binding.InstanceID, keyspace, role, username, grants)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(service.rotation.GracePeriod)
+	query := `UPDATE bindings SET username = ?, password = ?, previous_username = ?, previous_expires_at = ?,
+		rotated_at = ? WHERE id = ?`
+	err = service.session.Query(query, username, password, binding.Username, expiresAt, now, binding.ID).Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	return &expiresAt, nil
+}
+
+// alternateUsername returns the other login of the binding used by dual rotation
+func alternateUsername(username string) string {
+	if strings.HasSuffix(username, alternateLoginSuffix) {
+		return strings.TrimSuffix(username, alternateLoginSuffix)
+	}
+	return username + alternateLoginSuffix
+}
+
+const alternateLoginSuffix = "-b"
+
+// ReapPreviousCredentials drops logins of the bindings replaced by dual rotation
+// once their grace period is over
+func (service *cassandraService) ReapPreviousCredentials() error {
+	var binding rotationBinding
+
+	query := "SELECT id, instance_id, previous_username, previous_expires_at FROM bindings"
+	iter := service.readQuery(query).Iter()
+	for iter.Scan(&binding.ID, &binding.InstanceID, &binding.PreviousUsername, &binding.PreviousExpiresAt) {
+		if binding.PreviousUsername == "" || binding.PreviousExpiresAt.After(time.Now()) {
+			continue
+		}
+
+		dropped, err := service.dropPreviousLogin(binding)
+		if err == nil && !dropped {
+			continue
+		}
+
+		result, details := AuditSucceeded, binding.PreviousUsername
+		if err != nil {
+			result, details = AuditFailed, err.Error()
+		}
+		service.audit(binding, AuditDropPreviousCredentials, "reaper", result, details)
+	}
+
+	return iter.Close()
+}
+
+// dropPreviousLogin drops the previous login of the binding if it is still recorded,
+// it reports false if the binding has been rotated meanwhile.
+// The login is recorded again if it fails to drop, so it is retried later
+func (service *cassandraService) dropPreviousLogin(binding rotationBinding) (bool, error) {
+	claimed, err := service.claimPreviousLogin(binding)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	err = service.dropUser(binding.PreviousUsername)
+	if err != nil {
+		restoreErr := service.restorePreviousLogin(binding)
+		if restoreErr != nil {
+			return false, fmt.Errorf("%s, failed to record login %s again: %s", err, binding.PreviousUsername, restoreErr)
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// claimPreviousLogin forgets the previous login of the binding unless it has been changed meanwhile,
+// the caller which has claimed the login is the only one to drop it
+func (service *cassandraService) claimPreviousLogin(binding rotationBinding) (bool, error) {
+	query := `UPDATE bindings SET previous_username = null, previous_expires_at = null
+		WHERE id = ? IF previous_username = ? AND previous_expires_at = ?`
+	return service.session.Query(query, binding.ID, binding.PreviousUsername, binding.PreviousExpiresAt).
+		MapScanCAS(make(map[string]interface{}))
+}
+
+// restorePreviousLogin records the claimed previous login of the binding again
+func (service *cassandraService) restorePreviousLogin(binding rotationBinding) error {
+	query := `UPDATE bindings SET previous_username = ?, previous_expires_at = ?
+		WHERE id = ? IF previous_username = null`
+	applied, err := service.session.Query(query, binding.PreviousUsername, binding.PreviousExpiresAt, binding.ID).
+		MapScanCAS(make(map[string]interface{}))
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return errors.New("binding has been rotated concurrently")
+	}
+	return nil
+}
+
+// findRotationBindings returns completely created bindings matched by the scope
+func (service *cassandraService) findRotationBindings(scope RotationScope) ([]rotationBinding, error) {
+	var query *gocql.Query
+	columns := "id, instance_id, app_guid, username, previous_username, previous_expires_at, permissions, " +
+		"table_permissions, state"
+	if scope.BindingID != "" {
+		query = service.readQuery("SELECT "+columns+" FROM bindings WHERE id = ?", scope.BindingID)
+	} else if scope.InstanceID != "" {
+		query = service.readQuery("SELECT "+columns+" FROM bindings WHERE instance_id = ?", scope.InstanceID)
+	} else {
+		query = service.readQuery("SELECT " + columns + " FROM bindings")
+	}
+
+	var bindings []rotationBinding
+	var binding rotationBinding
+	var state string
+
+	iter := query.Iter()
+	for iter.Scan(&binding.ID, &binding.InstanceID, &binding.AppGUID, &binding.Username, &binding.PreviousUsername,
+		&binding.PreviousExpiresAt, &binding.Permissions, &binding.TablePermissions, &state) {
+		if state == stateCreating || state == stateExpired {
+			continue
+		}
+		if scope.InstanceID != "" && binding.InstanceID != scope.InstanceID {
+			continue
+		}
+		bindings = append(bindings, binding)
+	}
+	err := iter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(bindings, func(i, j int) bool {
+		return bindings[i].ID < bindings[j].ID
+	})
+
+	return bindings, nil
+}
+
+// audit records administrative action on the binding
+func (service *cassandraService) audit(binding rotationBinding, action, actor, result, details string) {
+	auditLogger.Printf("Audit: %s of binding %s of instance %s by %s %s %s",
+		action, binding.ID, binding.InstanceID, actor, result, details)
+
+	err := service.session.Query(`INSERT INTO
+		audit_events(binding_id, id, instance_id, action, actor, result, details, created_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+		binding.ID, gocql.TimeUUID(), binding.InstanceID, action, actor, result, details, time.Now()).Exec()
+	if err != nil {
+		auditLogger.Printf("Failed to record audit event of binding %s: %s", binding.ID, err)
+	}
+}
@@ -1,3 +1,92 @@
 package api
 
-const Version = "2.4"
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/cloudfoundry-community/types-cf"
+)
+
+// Version is the latest Broker API version supported by the broker
+const Version = "2.14"
+
+// MinVersion is the oldest Broker API version supported by the broker
+const MinVersion = "2.4"
+
+const VersionHeader = "X-Broker-API-Version"
+
+type APIVersion struct {
+	Major int
+	Minor int
+}
+
+func ParseAPIVersion(version string) (APIVersion, error) {
+	var v APIVersion
+
+	_, err := fmt.Sscanf(version, "%d.%d", &v.Major, &v.Minor)
+	if err != nil || fmt.Sprintf("%d.%d", v.Major, v.Minor) != version {
+		return APIVersion{}, fmt.Errorf("invalid Broker API version %q", version)
+	}
+
+	return v, nil
+}
+
+// AtLeast reports whether version is the same as or newer than major.minor
+func (v APIVersion) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+func (v APIVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+var (
+	latestVersion, _ = ParseAPIVersion(Version)
+	minVersion, _    = ParseAPIVersion(MinVersion)
+)
+
+type versionContextKey struct{}
+
+// RequestAPIVersion returns Broker API version negotiated for the request,
+// the latest supported one if the request has not been negotiated
+func RequestAPIVersion(r *http.Request) APIVersion {
+	version, ok := r.Context().Value(versionContextKey{}).(APIVersion)
+	if !ok {
+		return latestVersion
+	}
+	return version
+}
+
+// VersionNegotiator rejects requests of platforms using unsupported Broker API version
+type VersionNegotiator struct{}
+
+func NewVersionNegotiator() *VersionNegotiator {
+	return &VersionNegotiator{}
+}
+
+func (n *VersionNegotiator) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	header := r.Header.Get(VersionHeader)
+	if header == "" {
+		renderer.JSON(rw, http.StatusPreconditionFailed, cf.BrokerError{
+			Description: fmt.Sprintf("%s header is required", VersionHeader),
+		})
+		return
+	}
+
+	version, err := ParseAPIVersion(header)
+	if err != nil {
+		renderer.JSON(rw, http.StatusPreconditionFailed, cf.BrokerError{Description: err.Error()})
+		return
+	}
+
+	if version.Major != latestVersion.Major || !version.AtLeast(minVersion.Major, minVersion.Minor) {
+		renderer.JSON(rw, http.StatusPreconditionFailed, cf.BrokerError{
+			Description: fmt.Sprintf("Broker API version %s is not supported, expected %d.x starting from %s",
+				version, latestVersion.Major, MinVersion),
+		})
+		return
+	}
+
+	next(rw, r.WithContext(context.WithValue(r.Context(), versionContextKey{}, version)))
+}
@@ -0,0 +1,99 @@
+package api_test
+
+import (
+	"github.com/Altoros/cf-cassandra-broker/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codegangsta/negroni"
+
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Version", func() {
+	Describe(".ParseAPIVersion", func() {
+		It("parses major and minor versions", func() {
+			version, err := api.ParseAPIVersion("2.13")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(version).To(Equal(api.APIVersion{Major: 2, Minor: 13}))
+		})
+
+		It("returns error for malformed version", func() {
+			_, err := api.ParseAPIVersion("2.x")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("VersionNegotiator", func() {
+		var recorder *httptest.ResponseRecorder
+		var negotiated api.APIVersion
+
+		serve := func(header string) {
+			handler := negroni.New(api.NewVersionNegotiator())
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				negotiated = api.RequestAPIVersion(r)
+			})
+
+			request, _ := http.NewRequest("GET", "/v2/catalog", nil)
+			if header != "" {
+				request.Header.Set(api.VersionHeader, header)
+			}
+			handler.ServeHTTP(recorder, request)
+		}
+
+		BeforeEach(func() {
+			recorder = httptest.NewRecorder()
+			negotiated = api.APIVersion{}
+		})
+
+		Context("supported version", func() {
+			BeforeEach(func() {
+				serve("2.7")
+			})
+
+			It("returns a status code of 200", func() {
+				Ω(recorder.Code).To(Equal(200))
+			})
+
+			It("puts negotiated version on the request", func() {
+				Ω(negotiated).To(Equal(api.APIVersion{Major: 2, Minor: 7}))
+			})
+		})
+
+		Context("too old version", func() {
+			BeforeEach(func() {
+				serve("2.3")
+			})
+
+			It("returns a status code of 412", func() {
+				Ω(recorder.Code).To(Equal(412))
+			})
+
+			It("returns json with error", func() {
+				Ω(recorder.Body).To(MatchJSON(`{"description": "Broker API version 2.3 is not supported, expected 2.x starting from 2.4"}`))
+			})
+		})
+
+		Context("another major version", func() {
+			BeforeEach(func() {
+				serve("3.0")
+			})
+
+			It("returns a status code of 412", func() {
+				Ω(recorder.Code).To(Equal(412))
+			})
+		})
+
+		Context("missing header", func() {
+			BeforeEach(func() {
+				serve("")
+			})
+
+			It("returns a status code of 412", func() {
+				Ω(recorder.Code).To(Equal(412))
+			})
+		})
+	})
+})
@@ -1,7 +1,7 @@
 package broker
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"net/http"
 	"time"
@@ -16,55 +16,112 @@ import (
 type AppContext struct {
 	config           *config.Config
 	serveMux         *http.ServeMux
+	server           *http.Server
 	cassandraSession *gocql.Session
+	reaper           *api.Reaper
+	drain            *api.Drain
+	tls              *tlsReloader
+
+	api         *switchHandler
+	admin       *switchHandler
+	readiness   *api.Readiness
+	stopConnect chan struct{}
+	connectDone chan struct{}
 }
 
+// New returns the broker serving the catalog, it connects to Cassandra in background
+// and refuses other requests until connected
 func New(appConfig *config.Config) (*AppContext, error) {
 	app := new(AppContext)
 	app.config = appConfig
-	session, err := newCassandraSession(&appConfig.Cassandra)
-	if err != nil {
-		return nil, fmt.Errorf("can't start cassandra session: %s", err)
-	}
-	app.cassandraSession = session
+	app.drain = api.NewDrain()
+	app.readiness = api.NewReadiness()
+	app.stopConnect = make(chan struct{})
+	app.connectDone = make(chan struct{})
 
 	app.serveMux = http.NewServeMux()
+	app.serveMux.Handle("/ready", app.readiness)
+
 	apiAuthHandler := httpauth.SimpleBasicAuth(appConfig.Username, appConfig.Password)
-	api := api.New(app.config, app.cassandraSession)
-	app.serveMux.Handle("/v2/", apiAuthHandler(api))
+	app.api = &switchHandler{fallback: api.NewDegraded(app.config)}
+	app.serveMux.Handle("/v2/", apiAuthHandler(app.api))
+
+	if appConfig.Admin.Username != "" {
+		adminAuthHandler := httpauth.SimpleBasicAuth(appConfig.Admin.Username, appConfig.Admin.Password)
+		app.admin = &switchHandler{fallback: http.HandlerFunc(api.NotConnected)}
+		app.serveMux.Handle("/admin/", adminAuthHandler(app.admin))
+	}
+
+	app.server = &http.Server{Addr: ":" + appConfig.PortStr(), Handler: app.serveMux}
+	if appConfig.TLS.Enabled() {
+		var err error
+		app.tls, err = newTLSReloader(&appConfig.TLS)
+		if err != nil {
+			return nil, err
+		}
+		app.server.TLSConfig = app.tls.serverConfig()
+	}
+
+	go app.connect()
 
 	return app, nil
 }
 
-func (app *AppContext) Start() {
-	port := app.config.PortStr()
-	log.Println("Start broker on port", port)
-	http.ListenAndServe(":"+port, app.serveMux)
+// Start serves the broker until it is stopped, it returns error if the broker fails to listen
+func (app *AppContext) Start() error {
+	var err error
+	if app.tls != nil {
+		log.Println("Start broker with TLS on port", app.config.PortStr())
+		err = app.server.ListenAndServeTLS("", "")
+	} else {
+		log.Println("Start broker on port", app.config.PortStr())
+		err = app.server.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// ReloadCertificates loads TLS certificates of the listener from disk,
+// established connections keep working with the previous ones
+func (app *AppContext) ReloadCertificates() error {
+	if app.tls == nil {
+		return nil
+	}
+	return app.tls.Reload()
 }
 
+// Stop refuses new mutating requests, waits for running requests and operations
+// up to the shutdown timeout and closes the Cassandra session or stops connecting to it
 func (app *AppContext) Stop() {
 	log.Println("Stop broker")
-	app.cassandraSession.Close()
-}
+	app.drain.Start()
 
-func newCassandraSession(cfg *config.CassandraConfig) (*gocql.Session, error) {
-	cluster := gocql.NewCluster(cfg.Nodes...)
-	cluster.Keyspace = cfg.Keyspace
-	cluster.Timeout = 1 * time.Minute
-	cluster.NumConns = 1
-	if len(cfg.Nodes) == 1 {
-		cluster.Consistency = gocql.One
-	} else {
-		cluster.Consistency = gocql.All
+	ctx, cancel := context.WithTimeout(context.Background(), app.config.ShutdownTimeout)
+	defer cancel()
+
+	err := app.server.Shutdown(ctx)
+	if err != nil {
+		log.Println("Failed to drain requests:", err)
 	}
-	cluster.Authenticator = gocql.PasswordAuthenticator{
-		Username: cfg.Username,
-		Password: cfg.Password,
+
+	deadline, _ := ctx.Deadline()
+	if !app.drain.Wait(time.Until(deadline)) {
+		log.Println("Timed out waiting for running operations")
 	}
 
-	session, err := cluster.CreateSession()
-	if err != nil {
-		return nil, err
+	close(app.stopConnect)
+	<-app.connectDone
+	if app.cassandraSession == nil {
+		return
 	}
-	return session, nil
+
+	app.reaper.Stop()
+	app.cassandraSession.Close()
+}
+
+// NewCassandraSession connects to the broker keyspace
+func NewCassandraSession(cfg *config.CassandraConfig) (*gocql.Session, error) {
+	return cfg.NewCluster().CreateSession()
 }
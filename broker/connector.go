@@ -0,0 +1,99 @@
+package broker
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/Altoros/cf-cassandra-broker/api"
+)
+
+const (
+	initialConnectBackoff = time.Second
+	maxConnectBackoff     = time.Minute
+)
+
+// switchHandler serves the fallback handler until the connected one is set
+type switchHandler struct {
+	mutex     sync.RWMutex
+	fallback  http.Handler
+	connected http.Handler
+}
+
+func (h *switchHandler) set(handler http.Handler) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.connected = handler
+}
+
+func (h *switchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.RLock()
+	handler := h.connected
+	h.mutex.RUnlock()
+
+	if handler == nil {
+		handler = h.fallback
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// connect retries connecting to Cassandra with exponential backoff until it succeeds or the broker stops
+func (app *AppContext) connect() {
+	defer close(app.connectDone)
+
+	backoff := initialConnectBackoff
+	for {
+		err := app.tryConnect()
+		if err == nil {
+			log.Println("Connected to Cassandra")
+			return
+		}
+
+		app.readiness.SetFailed(err)
+		log.Printf("Failed to connect to Cassandra, retrying in %s: %s", backoff, err)
+
+		select {
+		case <-app.stopConnect:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
+
+// tryConnect opens the session and switches the broker to the handlers using it
+func (app *AppContext) tryConnect() error {
+	session, err := NewCassandraSession(&app.config.Cassandra)
+	if err != nil {
+		return fmt.Errorf("can't start cassandra session: %s", err)
+	}
+
+	dialect, err := api.DetectDialect(session)
+	if err != nil {
+		session.Close()
+		return err
+	}
+
+	app.cassandraSession = session
+	app.reaper = api.NewReaper(app.config, session, dialect)
+	app.reaper.Start()
+
+	app.api.set(api.New(app.config, session, dialect, app.drain))
+	if app.admin != nil {
+		app.admin.set(api.NewAdmin(app.config, session, dialect, app.drain))
+	}
+	app.readiness.SetReady(func() error {
+		return session.Query("SELECT release_version FROM system.local").Consistency(gocql.One).Exec()
+	})
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package broker
+
+import (
+	"crypto/tls"
+	"sync"
+
+	"github.com/Altoros/cf-cassandra-broker/config"
+)
+
+// tlsReloader serves TLS config of the listener loaded from disk,
+// connections accepted after Reload use the new certificates
+type tlsReloader struct {
+	config *config.TLSConfig
+
+	mutex   sync.RWMutex
+	current *tls.Config
+}
+
+func newTLSReloader(tlsConfig *config.TLSConfig) (*tlsReloader, error) {
+	reloader := &tlsReloader{config: tlsConfig}
+
+	err := reloader.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload loads certificates from disk, the previous ones are kept if it fails
+func (r *tlsReloader) Reload() error {
+	current, err := r.config.ServerTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.current = current
+
+	return nil
+}
+
+// serverConfig returns config of the listener resolving TLS config per connection
+func (r *tlsReloader) serverConfig() *tls.Config {
+	return &tls.Config{GetConfigForClient: r.configForClient}
+}
+
+func (r *tlsReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.current, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/Altoros/cf-cassandra-broker/api"
+	"github.com/Altoros/cf-cassandra-broker/broker"
+	"github.com/Altoros/cf-cassandra-broker/config"
+)
+
+var (
+	configFile string
+	instanceID string
+	bindingID  string
+	all        bool
+)
+
+func init() {
+	flag.StringVar(&configFile, "c", "", "Configuration File")
+	flag.StringVar(&instanceID, "instance", "", "Rotate credentials of all bindings of the service instance")
+	flag.StringVar(&bindingID, "binding", "", "Rotate credentials of the binding")
+	flag.BoolVar(&all, "all", false, "Rotate credentials of every binding")
+
+	flag.Parse()
+}
+
+func main() {
+	if configFile == "" {
+		fmt.Fprintln(os.Stderr, "Error: no config file specified")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	scope := api.RotationScope{InstanceID: instanceID, BindingID: bindingID}
+	if scope == (api.RotationScope{}) && !all || scope != (api.RotationScope{}) && all {
+		fmt.Fprintln(os.Stderr, "Error: specify either -binding, -instance or -all")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	config, err := config.InitFromFile(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading config: "+err.Error())
+		os.Exit(1)
+	}
+
+	session, err := broker.NewCassandraSession(&config.Cassandra)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error connecting to cassandra: "+err.Error())
+		os.Exit(1)
+	}
+	defer session.Close()
+
+	dialect, err := api.DetectDialect(session)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: "+err.Error())
+		os.Exit(1)
+	}
+
+	response, serviceError := api.NewCredentialRotator(config, session, dialect).RotateCredentials(scope, actor())
+	if serviceError != nil {
+		fmt.Fprintln(os.Stderr, "Error rotating credentials: "+serviceError.String())
+		os.Exit(1)
+	}
+
+	report, _ := json.MarshalIndent(response, "", "  ")
+	fmt.Println(string(report))
+
+	for _, binding := range response.Bindings {
+		if binding.Error != "" {
+			os.Exit(2)
+		}
+	}
+}
+
+// actor returns name recorded in the audit log for the rotation
+func actor() string {
+	current, err := user.Current()
+	if err != nil {
+		return "cli"
+	}
+	return "cli:" + current.Username
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"syscall"
 
 	"github.com/Altoros/cf-cassandra-broker/broker"
 	"github.com/Altoros/cf-cassandra-broker/config"
@@ -41,17 +42,51 @@ func main() {
 		log.Fatalf("Error creating broker: %s", err.Error())
 	}
 
+	failed := make(chan error, 1)
 	go func() {
-		broker.Start()
+		failed <- broker.Start()
 	}()
-	handleSignals()
+
+	err = waitForShutdown(broker, failed)
 	broker.Stop()
+
+	if err != nil {
+		os.Exit(1)
+	}
 }
 
-func handleSignals() {
+func handleSignals() <-chan os.Signal {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
-	<-c
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	return c
+}
+
+// waitForShutdown reloads certificates on SIGHUP until the broker is signaled to stop or fails
+func waitForShutdown(app *broker.AppContext, failed <-chan error) error {
+	signals := handleSignals()
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				reloadCertificates(app)
+				continue
+			}
+			log.Println("Received signal", sig)
+			return nil
+		case err := <-failed:
+			log.Println("Error serving broker:", err)
+			return err
+		}
+	}
+}
+
+func reloadCertificates(app *broker.AppContext) {
+	err := app.ReloadCertificates()
+	if err != nil {
+		log.Println("Error reloading certificates:", err)
+		return
+	}
+	log.Println("Reloaded certificates")
 }
 
 func writePid() {
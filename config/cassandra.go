@@ -1,15 +1,221 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
 type CassandraConfig struct {
-	Nodes      []string `yaml:"nodes"`
-	CqlPort    uint16   `yaml:"cql_port"`
-	ThriftPort uint16   `yaml:"thrift_port"`
-	Keyspace   string   `yaml:"keyspace"`
-	Username   string   `yaml:"username"`
-	Password   string   `yaml:"password"`
+	Nodes      []string           `yaml:"nodes"`
+	CqlPort    uint16             `yaml:"cql_port"`
+	ThriftPort uint16             `yaml:"thrift_port"`
+	Keyspace   string             `yaml:"keyspace"`
+	Username   string             `yaml:"username"`
+	Password   string             `yaml:"password"`
+	TLS        CassandraTLSConfig `yaml:"tls"`
+
+	Consistency    ConsistencyConfig `yaml:"consistency"`
+	Timeout        time.Duration     `yaml:"timeout"`
+	ConnectTimeout time.Duration     `yaml:"connect_timeout"`
+	NumConns       int               `yaml:"num_conns"`
+
+	// ProtocolVersion of the native protocol, it is negotiated with the cluster if not set
+	ProtocolVersion int `yaml:"protocol_version"`
+
+	// RetryAttempts is how many times a failed query is retried
+	RetryAttempts int `yaml:"retry_attempts"`
+
+	// LocalDatacenter makes queries go to nodes of the datacenter,
+	// other datacenters are only used if all of its nodes are down
+	LocalDatacenter string `yaml:"local_datacenter"`
+
+	// ReplicationFactor of the broker keyspace created by the migrate tool,
+	// lightweight transactions of the broker need a quorum of its replicas
+	ReplicationFactor int `yaml:"replication_factor"`
+}
+
+// ConsistencyConfig describes consistency levels of broker queries,
+// DDL covers schema changes and access control statements
+// and Serial the paxos phase of lightweight transactions
+type ConsistencyConfig struct {
+	Read   string `yaml:"read"`
+	Write  string `yaml:"write"`
+	DDL    string `yaml:"ddl"`
+	Serial string `yaml:"serial"`
+}
+
+var serialConsistencies = map[string]gocql.SerialConsistency{
+	"SERIAL":       gocql.Serial,
+	"LOCAL_SERIAL": gocql.LocalSerial,
+}
+
+// CassandraTLSConfig describes client-to-node encryption of the Cassandra cluster
+type CassandraTLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// CAFile verifies certificates of the nodes, system roots are used if it is not set
+	CAFile string `yaml:"ca_file"`
+
+	// CertFile and KeyFile are client certificate presented to the nodes
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+
+	// VerifyHost checks that certificates of the nodes are valid for their addresses
+	VerifyHost bool `yaml:"verify_host"`
+
+	// ShareCA adds the CA certificate to binding credentials
+	ShareCA bool `yaml:"share_ca"`
 }
 
 var defaultCassandraConfig = CassandraConfig{
 	CqlPort:    9042,
 	ThriftPort: 9160,
+	TLS: CassandraTLSConfig{
+		VerifyHost: true,
+	},
+	Timeout:        time.Minute,
+	ConnectTimeout: 600 * time.Millisecond,
+	NumConns:       1,
+}
+
+// setDefaults fills settings which are not configured. The broker keyspace of a single node cluster
+// has one replica read and written with consistency ONE, otherwise it has 3 replicas and QUORUM is used.
+// Lightweight transactions stay in the local datacenter if it is set
+func (c *CassandraConfig) setDefaults() {
+	level := "QUORUM"
+	replicationFactor := 3
+	if len(c.Nodes) == 1 {
+		level = "ONE"
+		replicationFactor = 1
+	}
+
+	if c.ReplicationFactor == 0 {
+		c.ReplicationFactor = replicationFactor
+	}
+
+	for _, consistency := range []*string{&c.Consistency.Read, &c.Consistency.Write, &c.Consistency.DDL} {
+		if *consistency == "" {
+			*consistency = level
+		}
+	}
+
+	if c.Consistency.Serial == "" {
+		c.Consistency.Serial = "SERIAL"
+		if c.LocalDatacenter != "" {
+			c.Consistency.Serial = "LOCAL_SERIAL"
+		}
+	}
+}
+
+func (c *CassandraConfig) Validate() error {
+	levels := map[string]string{"read": c.Consistency.Read, "write": c.Consistency.Write, "ddl": c.Consistency.DDL}
+	for _, kind := range []string{"read", "write", "ddl"} {
+		_, err := gocql.ParseConsistencyWrapper(levels[kind])
+		if err != nil {
+			return fmt.Errorf("invalid cassandra %s consistency %q", kind, levels[kind])
+		}
+	}
+
+	if _, ok := serialConsistencies[strings.ToUpper(c.Consistency.Serial)]; !ok {
+		return fmt.Errorf("invalid cassandra serial consistency %q", c.Consistency.Serial)
+	}
+
+	if c.Timeout <= 0 || c.ConnectTimeout <= 0 {
+		return errors.New("cassandra timeout and connect_timeout must be positive")
+	}
+
+	if c.NumConns < 1 {
+		return fmt.Errorf("invalid cassandra num_conns %d", c.NumConns)
+	}
+
+	if c.ProtocolVersion < 0 || c.ProtocolVersion > 4 {
+		return fmt.Errorf("unsupported cassandra protocol_version %d", c.ProtocolVersion)
+	}
+
+	if c.ReplicationFactor < 1 {
+		return fmt.Errorf("invalid cassandra replication_factor %d", c.ReplicationFactor)
+	}
+
+	if c.RetryAttempts < 0 {
+		return fmt.Errorf("invalid cassandra retry_attempts %d", c.RetryAttempts)
+	}
+
+	return c.TLS.Validate()
+}
+
+// NewCluster returns cluster config of the broker keyspace,
+// queries are run with the write consistency unless they set another one
+func (c *CassandraConfig) NewCluster() *gocql.ClusterConfig {
+	cluster := gocql.NewCluster(c.Nodes...)
+	cluster.Keyspace = c.Keyspace
+	cluster.Port = int(c.CqlPort)
+	cluster.Consistency = gocql.ParseConsistency(c.Consistency.Write)
+	cluster.SerialConsistency = serialConsistencies[strings.ToUpper(c.Consistency.Serial)]
+	cluster.Timeout = c.Timeout
+	cluster.ConnectTimeout = c.ConnectTimeout
+	cluster.NumConns = c.NumConns
+	cluster.ProtoVersion = c.ProtocolVersion
+	cluster.Authenticator = gocql.PasswordAuthenticator{
+		Username: c.Username,
+		Password: c.Password,
+	}
+	cluster.SslOpts = c.SslOptions()
+
+	if c.RetryAttempts > 0 {
+		cluster.RetryPolicy = &gocql.SimpleRetryPolicy{NumRetries: c.RetryAttempts}
+	}
+
+	if c.LocalDatacenter != "" {
+		cluster.PoolConfig.HostSelectionPolicy = DCAwareHostPolicy(c.LocalDatacenter)
+	}
+
+	return cluster
+}
+
+func (t *CassandraTLSConfig) Validate() error {
+	if !t.Enabled {
+		return nil
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("cassandra tls cert_file and key_file must be set together")
+	}
+
+	if t.ShareCA && t.CAFile == "" {
+		return errors.New("cassandra tls share_ca requires ca_file")
+	}
+
+	return nil
+}
+
+// SslOptions returns TLS options of the gocql cluster, nil if TLS is disabled
+func (c *CassandraConfig) SslOptions() *gocql.SslOptions {
+	if !c.TLS.Enabled {
+		return nil
+	}
+
+	return &gocql.SslOptions{
+		CaPath:                 c.TLS.CAFile,
+		CertPath:               c.TLS.CertFile,
+		KeyPath:                c.TLS.KeyFile,
+		EnableHostVerification: c.TLS.VerifyHost,
+	}
+}
+
+// CACertificate returns PEM encoded CA certificate shared with bindings, empty if it is not shared
+func (c *CassandraConfig) CACertificate() (string, error) {
+	if !c.TLS.Enabled || !c.TLS.ShareCA {
+		return "", nil
+	}
+
+	data, err := ioutil.ReadFile(c.TLS.CAFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read cassandra CA file: %s", err.Error())
+	}
+	return string(data), nil
 }
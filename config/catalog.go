@@ -1,17 +1,35 @@
 package config
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/Altoros/cf-cassandra-broker/schema"
+)
+
 type CatalogConfig struct {
 	Services []ServiceConfig `yaml:"services" json:"services"`
+
+	services map[string]*ServiceConfig
+	plans    map[string]catalogPlan
+}
+
+type catalogPlan struct {
+	service *ServiceConfig
+	plan    *PlanConfig
 }
 
 type ServiceConfig struct {
-	Id          string                `yaml:"id"          json:"id"`
-	Name        string                `yaml:"name"        json:"name"`
-	Description string                `yaml:"description" json:"description"`
-	Bindable    bool                  `yaml:"bindable"    json:"bindable"`
-	Tags        []string              `yaml:"tags"        json:"tags"`
-	Metadata    ServiceMetadataConfig `yaml:"metadata"    json:"metadata"`
-	Plans       []PlanConfig          `yaml:"plans"       json:"plans"`
+	Id                   string                `yaml:"id"                    json:"id"`
+	Name                 string                `yaml:"name"                  json:"name"`
+	Description          string                `yaml:"description"           json:"description"`
+	Bindable             bool                  `yaml:"bindable"              json:"bindable"`
+	PlanUpdateable       bool                  `yaml:"plan_updateable"       json:"plan_updateable,omitempty"`
+	InstancesRetrievable bool                  `yaml:"instances_retrievable" json:"instances_retrievable,omitempty"`
+	BindingsRetrievable  bool                  `yaml:"bindings_retrievable"  json:"bindings_retrievable,omitempty"`
+	Tags                 []string              `yaml:"tags"                  json:"tags"`
+	Metadata             ServiceMetadataConfig `yaml:"metadata"              json:"metadata"`
+	Plans                []PlanConfig          `yaml:"plans"                 json:"plans"`
 }
 
 type ServiceMetadataConfig struct {
@@ -24,10 +42,14 @@ type ServiceMetadataConfig struct {
 }
 
 type PlanConfig struct {
-	Id          string             `json:"id"`
-	Name        string             `json:"name"`
-	Description string             `json:"description"`
-	Metadata    PlanMetadataConfig `json:"metadata"`
+	Id                 string             `json:"id"`
+	Name               string             `json:"name"`
+	Description        string             `json:"description"`
+	Metadata           PlanMetadataConfig `json:"metadata"`
+	Schemas            *PlanSchemasConfig `yaml:"schemas"             json:"schemas,omitempty"`
+	Keyspace           KeyspaceConfig     `yaml:"keyspace"            json:"-"`
+	PermissionProfiles []string           `yaml:"permission_profiles" json:"-"`
+	MaxBindingTTL      time.Duration      `yaml:"max_binding_ttl"     json:"-"`
 }
 
 type PlanMetadataConfig struct {
@@ -39,3 +61,75 @@ type PlanCostConfig struct {
 	Unit   string             `yaml:"unit"   json:"unit"`
 	Amount map[string]float32 `yaml:"amount" json:"amount"`
 }
+
+// Index validates plans and builds lookup tables of services and plans by id,
+// it is called once the config is loaded and must be called again after the catalog is modified.
+// Lookups are not safe to run concurrently with it
+func (c *CatalogConfig) Index() error {
+	services := make(map[string]*ServiceConfig)
+	plans := make(map[string]catalogPlan)
+
+	for i := range c.Services {
+		service := &c.Services[i]
+		if _, ok := services[service.Id]; ok {
+			return fmt.Errorf("duplicate service id %q in catalog", service.Id)
+		}
+		services[service.Id] = service
+
+		for j := range service.Plans {
+			plan := &service.Plans[j]
+			if _, ok := plans[plan.Id]; ok {
+				return fmt.Errorf("duplicate plan id %q in catalog", plan.Id)
+			}
+			if err := plan.Keyspace.Validate(); err != nil {
+				return fmt.Errorf("plan %q keyspace: %s", plan.Id, err)
+			}
+			if err := plan.validatePermissionProfiles(); err != nil {
+				return fmt.Errorf("plan %q: %s", plan.Id, err)
+			}
+			if err := schema.Check(plan.CreateParametersSchema()); err != nil {
+				return fmt.Errorf("plan %q parameters schema: %s", plan.Id, err)
+			}
+			if plan.MaxBindingTTL < 0 {
+				return fmt.Errorf("plan %q: invalid max_binding_ttl %s", plan.Id, plan.MaxBindingTTL)
+			}
+			plans[plan.Id] = catalogPlan{service: service, plan: plan}
+		}
+	}
+
+	c.services = services
+	c.plans = plans
+
+	return nil
+}
+
+// FindService returns service with given id or nil if there is no such service
+func (c *CatalogConfig) FindService(id string) *ServiceConfig {
+	return c.services[id]
+}
+
+// ResolvePlan returns service and plan with given ids
+// or an error describing which of them is not in the catalog
+func (c *CatalogConfig) ResolvePlan(serviceID, planID string) (*ServiceConfig, *PlanConfig, error) {
+	service, ok := c.services[serviceID]
+	if !ok {
+		return nil, nil, fmt.Errorf("Unknown service_id %q", serviceID)
+	}
+
+	entry, ok := c.plans[planID]
+	if !ok || entry.service != service {
+		return nil, nil, fmt.Errorf("Unknown plan_id %q for service %q", planID, service.Name)
+	}
+
+	return service, entry.plan, nil
+}
+
+// FindPlan returns service plan with given id or nil if there is no such plan
+func (s *ServiceConfig) FindPlan(id string) *PlanConfig {
+	for i := range s.Plans {
+		if s.Plans[i].Id == id {
+			return &s.Plans[i]
+		}
+	}
+	return nil
+}
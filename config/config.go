@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"strconv"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -11,13 +13,36 @@ type Config struct {
 	Username  string          `yaml:"username"`
 	Password  string          `yaml:"password"`
 	Port      uint16          `yaml:"port"`
+	TLS       TLSConfig       `yaml:"tls"`
 	Catalog   CatalogConfig   `yaml:"catalog"`
 	Cassandra CassandraConfig `yaml:"cassandra"`
+	Admin     AdminConfig     `yaml:"admin"`
+	Rotation  RotationConfig  `yaml:"rotation"`
+
+	// ShutdownTimeout limits how long the broker waits for running requests and operations on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// KeyspaceNameTemplate is a text/template keyspace names of instances are rendered from
+	KeyspaceNameTemplate string `yaml:"keyspace_name_template"`
+}
+
+// AdminConfig describes credentials of administrative endpoints,
+// the endpoints are disabled if username is not set
+type AdminConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
 }
 
+const defaultShutdownTimeout = 30 * time.Second
+
 var defaultConfig = Config{
 	Port:      80,
+	TLS:       defaultTLSConfig,
 	Cassandra: defaultCassandraConfig,
+	Rotation:  defaultRotationConfig,
+
+	ShutdownTimeout:      defaultShutdownTimeout,
+	KeyspaceNameTemplate: DefaultKeyspaceNameTemplate,
 }
 
 func Default() *Config {
@@ -27,7 +52,38 @@ func Default() *Config {
 }
 
 func (c *Config) Initialize(configYAML []byte) error {
-	return yaml.Unmarshal(configYAML, &c)
+	err := yaml.Unmarshal(configYAML, &c)
+	if err != nil {
+		return err
+	}
+
+	c.Cassandra.setDefaults()
+
+	err = c.Cassandra.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = c.TLS.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = c.Rotation.Validate()
+	if err != nil {
+		return err
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("invalid shutdown_timeout %s", c.ShutdownTimeout)
+	}
+
+	err = validateKeyspaceNameTemplate(c.KeyspaceNameTemplate)
+	if err != nil {
+		return err
+	}
+
+	return c.Catalog.Index()
 }
 
 func (c *Config) PortStr() string {
@@ -5,6 +5,11 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+
+	"github.com/gocql/gocql"
+
+	"encoding/json"
+	"time"
 )
 
 var _ = Describe("Config", func() {
@@ -26,6 +31,66 @@ var _ = Describe("Config", func() {
 			It("sets default value for thrift port", func() {
 				Ω(config.Cassandra.ThriftPort).To(Equal(uint16(9160)))
 			})
+
+			It("uses quorum consistency on clusters of several nodes", func() {
+				Ω(config.Initialize([]byte("cassandra: {nodes: [10.0.0.1, 10.0.0.2]}"))).Should(Succeed())
+				Ω(config.Cassandra.Consistency).To(Equal(ConsistencyConfig{
+					Read: "QUORUM", Write: "QUORUM", DDL: "QUORUM", Serial: "SERIAL",
+				}))
+			})
+
+			It("uses consistency ONE on a single node", func() {
+				Ω(config.Initialize([]byte("cassandra: {nodes: [127.0.0.1]}"))).Should(Succeed())
+				Ω(config.Cassandra.Consistency).To(Equal(ConsistencyConfig{
+					Read: "ONE", Write: "ONE", DDL: "ONE", Serial: "SERIAL",
+				}))
+				Ω(config.Cassandra.NewCluster().Consistency).To(Equal(gocql.One))
+			})
+
+			It("replicates the broker keyspace to every node of a single node cluster", func() {
+				Ω(config.Initialize([]byte("cassandra: {nodes: [127.0.0.1]}"))).Should(Succeed())
+				Ω(config.Cassandra.ReplicationFactor).To(Equal(1))
+			})
+
+			It("replicates the broker keyspace to 3 nodes of larger clusters", func() {
+				Ω(config.Initialize([]byte("cassandra: {nodes: [10.0.0.1, 10.0.0.2]}"))).Should(Succeed())
+				Ω(config.Cassandra.ReplicationFactor).To(Equal(3))
+			})
+
+			It("keeps lightweight transactions in the local datacenter", func() {
+				Ω(config.Initialize([]byte("cassandra: {nodes: [10.0.0.1, 10.0.0.2], local_datacenter: dc1}"))).Should(Succeed())
+				Ω(config.Cassandra.Consistency.Serial).To(Equal("LOCAL_SERIAL"))
+				Ω(config.Cassandra.NewCluster().SerialConsistency).To(Equal(gocql.LocalSerial))
+			})
+
+			It("keeps session settings of the previous versions", func() {
+				Ω(config.Initialize([]byte("cassandra: {nodes: [127.0.0.1]}"))).Should(Succeed())
+				cluster := config.Cassandra.NewCluster()
+				Ω(cluster.Timeout).To(Equal(time.Minute))
+				Ω(cluster.NumConns).To(Equal(1))
+				Ω(cluster.Port).To(Equal(9042))
+				Ω(cluster.ProtoVersion).To(Equal(0))
+				Ω(cluster.RetryPolicy).To(BeNil())
+				Ω(cluster.PoolConfig.HostSelectionPolicy).To(BeNil())
+			})
+
+			It("connects without TLS", func() {
+				Ω(config.Cassandra.TLS.Enabled).To(BeFalse())
+				Ω(config.Cassandra.SslOptions()).To(BeNil())
+			})
+		})
+
+		It("rotates credentials in place", func() {
+			Ω(config.Rotation.Mode).To(Equal(RotationInPlace))
+			Ω(config.Rotation.GracePeriod).To(Equal(24 * time.Hour))
+		})
+
+		It("waits 30 seconds on shutdown", func() {
+			Ω(config.ShutdownTimeout).To(Equal(30 * time.Second))
+		})
+
+		It("names keyspaces by random suffix", func() {
+			Ω(config.KeyspaceNameTemplate).To(Equal(DefaultKeyspaceNameTemplate))
 		})
 	})
 
@@ -35,6 +100,9 @@ var _ = Describe("Config", func() {
 catalog:
   services:
   - bindable: true
+    plan_updateable: true
+    instances_retrievable: true
+    bindings_retrievable: true
     name: cassandra
     description: cassandra
     id: service-id
@@ -67,6 +135,9 @@ catalog:
 			Ω(config.Catalog.Services[0].Name).To(Equal("cassandra"))
 			Ω(config.Catalog.Services[0].Description).To(Equal("cassandra"))
 			Ω(config.Catalog.Services[0].Bindable).To(BeTrue())
+			Ω(config.Catalog.Services[0].PlanUpdateable).To(BeTrue())
+			Ω(config.Catalog.Services[0].InstancesRetrievable).To(BeTrue())
+			Ω(config.Catalog.Services[0].BindingsRetrievable).To(BeTrue())
 			Ω(len(config.Catalog.Services[0].Tags)).To(Equal(2))
 			// Service metadata
 			Ω(config.Catalog.Services[0].Metadata.DisplayName).To(Equal("cassandra"))
@@ -89,6 +160,161 @@ catalog:
 
 		})
 
+		It("sets plan keyspace config", func() {
+			var b = []byte(`
+catalog:
+  services:
+  - id: service-id
+    plans:
+    - id: dev-id
+      name: dev
+    - id: multi-dc-id
+      name: multi-dc
+      keyspace:
+        replication_class: NetworkTopologyStrategy
+        datacenters:
+          dc1: 3
+          dc2: 2
+        durable_writes: false
+`)
+			err := config.Initialize(b)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			dev := config.Catalog.Services[0].Plans[0].Keyspace
+			Ω(dev.Class()).To(Equal(SimpleStrategy))
+			Ω(dev.Factor()).To(Equal(3))
+			Ω(dev.Durable()).To(BeTrue())
+
+			multiDC := config.Catalog.Services[0].Plans[1].Keyspace
+			Ω(multiDC.Class()).To(Equal(NetworkTopologyStrategy))
+			Ω(multiDC.Datacenters).To(Equal(map[string]int{"dc1": 3, "dc2": 2}))
+			Ω(multiDC.Durable()).To(BeFalse())
+		})
+
+		It("sets plan parameters schema", func() {
+			var b = []byte(`
+catalog:
+  services:
+  - id: service-id
+    plans:
+    - id: plan-id
+      schemas:
+        service_instance:
+          create:
+            parameters:
+              type: object
+              properties:
+                replication_factor:
+                  type: integer
+                  maximum: 5
+`)
+			err := config.Initialize(b)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			plan := config.Catalog.Services[0].Plans[0]
+			Ω(plan.CreateParametersSchema()).To(Equal(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"replication_factor": map[string]interface{}{"type": "integer", "maximum": 5},
+				},
+			}))
+
+			catalogJSON, err := json.Marshal(plan)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(catalogJSON).To(ContainSubstring(`"schemas":{"service_instance":{"create":{"parameters":`))
+		})
+
+		It("rejects plan parameters schema with unsupported keywords", func() {
+			var b = []byte(`
+catalog:
+  services:
+  - id: service-id
+    plans:
+    - id: plan-id
+      schemas:
+        service_instance:
+          create:
+            parameters:
+              type: object
+              properties:
+                replication_factor:
+                  $ref: "#/definitions/factor"
+`)
+			err := config.Initialize(b)
+			Ω(err).Should(MatchError(`plan "plan-id" parameters schema: unsupported keyword "properties.replication_factor.$ref"`))
+		})
+
+		It("rejects invalid plan keyspace config", func() {
+			var b = []byte(`
+catalog:
+  services:
+  - id: service-id
+    plans:
+    - id: plan-id
+      keyspace:
+        replication_class: NetworkTopologyStrategy
+`)
+			err := config.Initialize(b)
+			Ω(err).Should(MatchError(`plan "plan-id" keyspace: NetworkTopologyStrategy requires datacenters`))
+		})
+
+		It("sets plan permission profiles", func() {
+			var b = []byte(`
+catalog:
+  services:
+  - id: service-id
+    plans:
+    - id: dev-id
+    - id: analytics-id
+      permission_profiles: [readonly, full]
+`)
+			err := config.Initialize(b)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(config.Catalog.Services[0].Plans[0].AllowedPermissionProfiles()).To(Equal([]string{FullPermissionProfile}))
+			Ω(config.Catalog.Services[0].Plans[1].AllowedPermissionProfiles()).To(Equal([]string{"readonly", "full"}))
+		})
+
+		It("sets plan maximum binding ttl", func() {
+			var b = []byte(`
+catalog:
+  services:
+  - id: service-id
+    plans:
+    - id: plan-id
+      max_binding_ttl: 72h
+`)
+			err := config.Initialize(b)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.Catalog.Services[0].Plans[0].MaxBindingTTL).To(Equal(72 * time.Hour))
+		})
+
+		It("rejects unknown permission profiles", func() {
+			var b = []byte(`
+catalog:
+  services:
+  - id: service-id
+    plans:
+    - id: plan-id
+      permission_profiles: [superuser]
+`)
+			err := config.Initialize(b)
+			Ω(err).Should(MatchError(`plan "plan-id": unknown permission profile "superuser"`))
+		})
+
+		It("normalizes permissions", func() {
+			permissions, err := NormalizePermissions([]string{"select", "MODIFY", "select"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(permissions).To(Equal([]string{"MODIFY", "SELECT"}))
+
+			permissions, err = NormalizePermissions([]string{"SELECT", "all"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(permissions).To(Equal([]string{PermissionAll}))
+
+			_, err = NormalizePermissions([]string{"SUPERUSER"})
+			Ω(err).Should(MatchError(`unknown permission "SUPERUSER"`))
+		})
+
 		It("sets cassandra config", func() {
 			var b = []byte(`
 cassandra:
@@ -110,6 +336,199 @@ cassandra:
 			Ω(config.Cassandra.ThriftPort).To(Equal(uint16(456)))
 		})
 
+		It("sets cassandra session config", func() {
+			var b = []byte(`
+cassandra:
+  nodes: [10.0.0.1, 10.0.0.2]
+  keyspace: broker
+  cql_port: 9142
+  consistency:
+    read: local_one
+    write: LOCAL_QUORUM
+    ddl: ALL
+  timeout: 10s
+  connect_timeout: 2s
+  num_conns: 4
+  protocol_version: 4
+  retry_attempts: 3
+  local_datacenter: dc1
+`)
+			err := config.Initialize(b)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			cluster := config.Cassandra.NewCluster()
+			Ω(cluster.Hosts).To(Equal([]string{"10.0.0.1", "10.0.0.2"}))
+			Ω(cluster.Keyspace).To(Equal("broker"))
+			Ω(cluster.Port).To(Equal(9142))
+			Ω(cluster.Consistency).To(Equal(gocql.LocalQuorum))
+			Ω(cluster.SerialConsistency).To(Equal(gocql.LocalSerial))
+			Ω(cluster.Timeout).To(Equal(10 * time.Second))
+			Ω(cluster.ConnectTimeout).To(Equal(2 * time.Second))
+			Ω(cluster.NumConns).To(Equal(4))
+			Ω(cluster.ProtoVersion).To(Equal(4))
+			Ω(cluster.RetryPolicy).To(Equal(&gocql.SimpleRetryPolicy{NumRetries: 3}))
+			Ω(cluster.PoolConfig.HostSelectionPolicy).ShouldNot(BeNil())
+		})
+
+		It("sets replication factor of the broker keyspace", func() {
+			Ω(config.Initialize([]byte("cassandra: {nodes: [127.0.0.1], replication_factor: 2}"))).Should(Succeed())
+			Ω(config.Cassandra.ReplicationFactor).To(Equal(2))
+		})
+
+		It("rejects invalid replication factor of the broker keyspace", func() {
+			err := config.Initialize([]byte("cassandra: {replication_factor: -1}"))
+			Ω(err).Should(MatchError("invalid cassandra replication_factor -1"))
+		})
+
+		It("rejects unknown serial consistency", func() {
+			var b = []byte(`
+cassandra:
+  consistency:
+    serial: QUORUM
+`)
+			Ω(config.Initialize(b)).Should(MatchError(`invalid cassandra serial consistency "QUORUM"`))
+		})
+
+		It("rejects unknown consistency", func() {
+			var b = []byte(`
+cassandra:
+  consistency:
+    read: MOST
+`)
+			Ω(config.Initialize(b)).Should(MatchError(`invalid cassandra read consistency "MOST"`))
+		})
+
+		It("rejects invalid connection count", func() {
+			var b = []byte(`
+cassandra:
+  num_conns: 0
+`)
+			Ω(config.Initialize(b)).Should(MatchError("invalid cassandra num_conns 0"))
+		})
+
+		It("rejects unsupported protocol version", func() {
+			var b = []byte(`
+cassandra:
+  protocol_version: 7
+`)
+			Ω(config.Initialize(b)).Should(MatchError("unsupported cassandra protocol_version 7"))
+		})
+
+		It("sets cassandra tls config", func() {
+			var b = []byte(`
+cassandra:
+  tls:
+    enabled: true
+    ca_file: /etc/broker/cassandra-ca.pem
+    cert_file: /etc/broker/cassandra-cert.pem
+    key_file: /etc/broker/cassandra-key.pem
+`)
+			err := config.Initialize(b)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			sslOptions := config.Cassandra.SslOptions()
+			Ω(sslOptions.CaPath).To(Equal("/etc/broker/cassandra-ca.pem"))
+			Ω(sslOptions.CertPath).To(Equal("/etc/broker/cassandra-cert.pem"))
+			Ω(sslOptions.KeyPath).To(Equal("/etc/broker/cassandra-key.pem"))
+			Ω(sslOptions.EnableHostVerification).To(BeTrue())
+		})
+
+		It("disables cassandra host verification", func() {
+			var b = []byte(`
+cassandra:
+  tls:
+    enabled: true
+    verify_host: false
+`)
+			err := config.Initialize(b)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.Cassandra.SslOptions().EnableHostVerification).To(BeFalse())
+		})
+
+		It("rejects cassandra client certificate without key", func() {
+			var b = []byte(`
+cassandra:
+  tls:
+    enabled: true
+    cert_file: /etc/broker/cassandra-cert.pem
+`)
+			Ω(config.Initialize(b)).Should(MatchError("cassandra tls cert_file and key_file must be set together"))
+		})
+
+		It("rejects sharing cassandra CA without CA file", func() {
+			var b = []byte(`
+cassandra:
+  tls:
+    enabled: true
+    share_ca: true
+`)
+			Ω(config.Initialize(b)).Should(MatchError("cassandra tls share_ca requires ca_file"))
+		})
+
+		It("sets rotation config", func() {
+			var b = []byte(`
+rotation:
+  mode: dual
+  grace_period: 2h
+`)
+			err := config.Initialize(b)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.Rotation.Mode).To(Equal(RotationDual))
+			Ω(config.Rotation.GracePeriod).To(Equal(2 * time.Hour))
+		})
+
+		It("rejects unknown rotation mode", func() {
+			var b = []byte(`
+rotation:
+  mode: triple
+`)
+			err := config.Initialize(b)
+			Ω(err).Should(MatchError(`unsupported rotation mode "triple"`))
+		})
+
+		It("sets shutdown timeout", func() {
+			var b = []byte(`
+shutdown_timeout: 2m
+`)
+			err := config.Initialize(b)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.ShutdownTimeout).To(Equal(2 * time.Minute))
+		})
+
+		It("rejects negative shutdown timeout", func() {
+			var b = []byte(`
+shutdown_timeout: -1s
+`)
+			err := config.Initialize(b)
+			Ω(err).Should(MatchError("invalid shutdown_timeout -1s"))
+		})
+
+		It("sets keyspace name template", func() {
+			var b = []byte(`
+keyspace_name_template: "{{.PlanName}}_{{.Random}}"
+`)
+			err := config.Initialize(b)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.KeyspaceNameTemplate).To(Equal("{{.PlanName}}_{{.Random}}"))
+		})
+
+		It("rejects keyspace name template referring unknown values", func() {
+			var b = []byte(`
+keyspace_name_template: "{{.AppName}}"
+`)
+			err := config.Initialize(b)
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).To(HavePrefix("invalid keyspace_name_template: "))
+		})
+
+		It("rejects keyspace name template without unique values", func() {
+			var b = []byte(`
+keyspace_name_template: "{{.PlanName}}_{{.OrganizationGUID}}"
+`)
+			err := config.Initialize(b)
+			Ω(err).Should(MatchError("invalid keyspace_name_template: it must refer .Random or .InstanceID"))
+		})
+
 		It("sets username", func() {
 			var b = []byte(`
 username: user
@@ -135,6 +554,99 @@ port: 8080
 		})
 	})
 
+	Describe("Catalog", func() {
+		BeforeEach(func() {
+			config.Catalog = CatalogConfig{
+				Services: []ServiceConfig{
+					ServiceConfig{
+						Id:    "service-id",
+						Plans: []PlanConfig{PlanConfig{Id: "plan-id", Name: "free"}},
+					},
+				},
+			}
+			Ω(config.Catalog.Index()).Should(Succeed())
+		})
+
+		It("finds service by id", func() {
+			Ω(config.Catalog.FindService("service-id")).To(Equal(&config.Catalog.Services[0]))
+			Ω(config.Catalog.FindService("unknown")).To(BeNil())
+		})
+
+		It("finds plan by id", func() {
+			service := config.Catalog.FindService("service-id")
+			Ω(service.FindPlan("plan-id").Name).To(Equal("free"))
+			Ω(service.FindPlan("unknown")).To(BeNil())
+		})
+
+		Describe("ResolvePlan", func() {
+			It("returns service and plan", func() {
+				service, plan, err := config.Catalog.ResolvePlan("service-id", "plan-id")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(service.Id).To(Equal("service-id"))
+				Ω(plan.Name).To(Equal("free"))
+			})
+
+			It("rejects unknown service", func() {
+				_, _, err := config.Catalog.ResolvePlan("unknown", "plan-id")
+				Ω(err).Should(MatchError(`Unknown service_id "unknown"`))
+			})
+
+			It("rejects plan of another service", func() {
+				config.Catalog.Services = append(config.Catalog.Services, ServiceConfig{
+					Id:    "another-service-id",
+					Name:  "another",
+					Plans: []PlanConfig{PlanConfig{Id: "another-plan-id"}},
+				})
+				Ω(config.Catalog.Index()).Should(Succeed())
+
+				_, _, err := config.Catalog.ResolvePlan("service-id", "another-plan-id")
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		It("rejects duplicate plan ids", func() {
+			config.Catalog.Services = append(config.Catalog.Services, ServiceConfig{
+				Id:    "another-service-id",
+				Plans: []PlanConfig{PlanConfig{Id: "plan-id"}},
+			})
+			Ω(config.Catalog.Index()).Should(MatchError(`duplicate plan id "plan-id" in catalog`))
+		})
+	})
+
+	Describe("KeyspaceName", func() {
+		data := KeyspaceNameData{
+			InstanceID:       "5f1d8b4c-instance",
+			OrganizationGUID: "0e4c9a8e-7a43-4d5c-8f10-6c1d2b3a4f5e",
+			SpaceGUID:        "a1b2c3d4-5e6f-4a5b-9c8d-7e6f5a4b3c2d",
+			PlanName:         "Small-Plan",
+			Random:           "abcdef0123456789abcd",
+		}
+
+		It("renders the template", func() {
+			name, err := KeyspaceName("{{.PlanName}}_{{.Random}}", data)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(name).To(Equal("small_plan_abcdef0123456789abcd"))
+		})
+
+		It("makes the name start with a letter", func() {
+			name, err := KeyspaceName("{{.InstanceID}}", data)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(name).To(Equal("cf_5f1d8b4c_instance"))
+		})
+
+		It("truncates long names keeping the random suffix", func() {
+			name, err := KeyspaceName("{{.OrganizationGUID}}_{{.SpaceGUID}}_{{.Random}}", data)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(len(name)).To(BeNumerically("<=", MaxKeyspaceNameLength))
+			Ω(name).To(MatchRegexp(`^[a-z][a-z0-9_]*_abcdef0123456789abcd$`))
+		})
+
+		It("rejects invalid templates", func() {
+			_, err := KeyspaceName("{{.PlanName", data)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
 	Describe("PortStr", func() {
 		It("returns port as string", func() {
 			config.Port = 1234
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gocql/gocql"
+)
+
+// DCAwareHostPolicy picks nodes of the local datacenter round robin,
+// nodes of other datacenters are tried only after all local ones
+func DCAwareHostPolicy(localDC string) gocql.HostSelectionPolicy {
+	return &dcAwareHostPolicy{localDC: localDC}
+}
+
+type dcAwareHostPolicy struct {
+	localDC string
+
+	mutex  sync.RWMutex
+	local  []*gocql.HostInfo
+	remote []*gocql.HostInfo
+	pos    uint32
+}
+
+type selectedHost struct {
+	info *gocql.HostInfo
+}
+
+func (h selectedHost) Info() *gocql.HostInfo {
+	return h.info
+}
+
+func (h selectedHost) Mark(error) {}
+
+func (p *dcAwareHostPolicy) SetPartitioner(string) {}
+
+func (p *dcAwareHostPolicy) AddHost(host *gocql.HostInfo) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if host.DataCenter() == p.localDC {
+		p.local = addHost(p.local, host)
+	} else {
+		p.remote = addHost(p.remote, host)
+	}
+}
+
+func (p *dcAwareHostPolicy) RemoveHost(host *gocql.HostInfo) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.local = removeHost(p.local, host)
+	p.remote = removeHost(p.remote, host)
+}
+
+func (p *dcAwareHostPolicy) HostUp(host *gocql.HostInfo) {
+	p.AddHost(host)
+}
+
+func (p *dcAwareHostPolicy) HostDown(host *gocql.HostInfo) {
+	p.RemoveHost(host)
+}
+
+func (p *dcAwareHostPolicy) Pick(gocql.ExecutableQuery) gocql.NextHost {
+	pos := atomic.AddUint32(&p.pos, 1)
+
+	p.mutex.RLock()
+	hosts := make([]*gocql.HostInfo, 0, len(p.local)+len(p.remote))
+	hosts = appendRotated(hosts, p.local, pos)
+	hosts = appendRotated(hosts, p.remote, pos)
+	p.mutex.RUnlock()
+
+	i := 0
+	return func() gocql.SelectedHost {
+		if i >= len(hosts) {
+			return nil
+		}
+		host := hosts[i]
+		i++
+		return selectedHost{info: host}
+	}
+}
+
+// appendRotated appends hosts starting from the position, so queries are spread over them
+func appendRotated(dst, hosts []*gocql.HostInfo, pos uint32) []*gocql.HostInfo {
+	for i := range hosts {
+		dst = append(dst, hosts[(int(pos)+i)%len(hosts)])
+	}
+	return dst
+}
+
+func addHost(hosts []*gocql.HostInfo, host *gocql.HostInfo) []*gocql.HostInfo {
+	for _, h := range hosts {
+		if h.Peer().Equal(host.Peer()) {
+			return hosts
+		}
+	}
+	return append(hosts, host)
+}
+
+func removeHost(hosts []*gocql.HostInfo, host *gocql.HostInfo) []*gocql.HostInfo {
+	for i, h := range hosts {
+		if h.Peer().Equal(host.Peer()) {
+			return append(hosts[:i:i], hosts[i+1:]...)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,93 @@
+package config_test
+
+import (
+	. "github.com/Altoros/cf-cassandra-broker/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/gocql/gocql"
+
+	"net"
+	"reflect"
+	"unsafe"
+)
+
+// hostInfo returns host of the datacenter, the vendored gocql sets addresses
+// and datacenters of hosts by unexported fields only
+func hostInfo(peer, dataCenter string) *gocql.HostInfo {
+	host := new(gocql.HostInfo)
+	value := reflect.ValueOf(host).Elem()
+	setField(value, "peer", net.ParseIP(peer))
+	setField(value, "dataCenter", dataCenter)
+	return host
+}
+
+func setField(value reflect.Value, name string, fieldValue interface{}) {
+	field := value.FieldByName(name)
+	reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Set(reflect.ValueOf(fieldValue))
+}
+
+var _ = Describe("DCAwareHostPolicy", func() {
+	var policy gocql.HostSelectionPolicy
+	local1 := hostInfo("10.0.0.1", "dc1")
+	local2 := hostInfo("10.0.0.2", "dc1")
+	remote := hostInfo("10.1.0.1", "dc2")
+
+	// picked returns addresses of all hosts the query is going to try in order
+	picked := func() []string {
+		var peers []string
+		next := policy.Pick(nil)
+		for host := next(); host != nil; host = next() {
+			peers = append(peers, host.Info().Peer().String())
+		}
+		return peers
+	}
+
+	BeforeEach(func() {
+		policy = DCAwareHostPolicy("dc1")
+		policy.AddHost(remote)
+		policy.AddHost(local1)
+		policy.AddHost(local2)
+	})
+
+	It("tries hosts of the local datacenter first", func() {
+		peers := picked()
+		Ω(peers).To(HaveLen(3))
+		Ω(peers[:2]).To(ConsistOf("10.0.0.1", "10.0.0.2"))
+		Ω(peers[2]).To(Equal("10.1.0.1"))
+	})
+
+	It("spreads queries over hosts of the local datacenter", func() {
+		Ω(picked()[0]).ShouldNot(Equal(picked()[0]))
+	})
+
+	It("falls back to other datacenters if all local hosts are down", func() {
+		policy.HostDown(local1)
+		policy.HostDown(local2)
+		Ω(picked()).To(Equal([]string{"10.1.0.1"}))
+	})
+
+	It("tries hosts again once they are up", func() {
+		policy.HostDown(local1)
+		policy.HostUp(local1)
+		Ω(picked()).To(HaveLen(3))
+	})
+
+	It("adds every host once", func() {
+		policy.AddHost(hostInfo("10.0.0.1", "dc1"))
+		policy.HostUp(remote)
+		Ω(picked()).To(HaveLen(3))
+	})
+
+	It("forgets removed hosts", func() {
+		policy.RemoveHost(local2)
+		policy.RemoveHost(remote)
+		Ω(picked()).To(Equal([]string{"10.0.0.1"}))
+	})
+
+	It("picks nothing without hosts", func() {
+		policy = DCAwareHostPolicy("dc1")
+		Ω(policy.Pick(nil)()).To(BeNil())
+	})
+})
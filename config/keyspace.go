@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	SimpleStrategy          = "SimpleStrategy"
+	NetworkTopologyStrategy = "NetworkTopologyStrategy"
+
+	defaultReplicationFactor = 3
+)
+
+var datacenterNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
+// KeyspaceConfig describes settings of keyspaces provisioned for the plan
+type KeyspaceConfig struct {
+	ReplicationClass  string         `yaml:"replication_class"`
+	ReplicationFactor int            `yaml:"replication_factor"`
+	Datacenters       map[string]int `yaml:"datacenters"`
+	DurableWrites     *bool          `yaml:"durable_writes"`
+}
+
+// Class returns replication class, SimpleStrategy by default
+func (k *KeyspaceConfig) Class() string {
+	if k.ReplicationClass == "" {
+		return SimpleStrategy
+	}
+	return k.ReplicationClass
+}
+
+// Factor returns replication factor of SimpleStrategy, 3 by default
+func (k *KeyspaceConfig) Factor() int {
+	if k.ReplicationFactor == 0 {
+		return defaultReplicationFactor
+	}
+	return k.ReplicationFactor
+}
+
+// Durable returns whether commit log is used for updates, true by default
+func (k *KeyspaceConfig) Durable() bool {
+	if k.DurableWrites == nil {
+		return true
+	}
+	return *k.DurableWrites
+}
+
+func (k *KeyspaceConfig) Validate() error {
+	switch k.Class() {
+	case SimpleStrategy:
+		if k.Factor() < 0 {
+			return fmt.Errorf("invalid replication_factor %d", k.ReplicationFactor)
+		}
+	case NetworkTopologyStrategy:
+		if len(k.Datacenters) == 0 {
+			return fmt.Errorf("%s requires datacenters", NetworkTopologyStrategy)
+		}
+		for datacenter, factor := range k.Datacenters {
+			if !datacenterNameRegexp.MatchString(datacenter) {
+				return fmt.Errorf("invalid datacenter name %q", datacenter)
+			}
+			if factor < 0 {
+				return fmt.Errorf("invalid replication factor %d of datacenter %q", factor, datacenter)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported replication_class %q", k.ReplicationClass)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const (
+	// DefaultKeyspaceNameTemplate names keyspaces by the random suffix only
+	DefaultKeyspaceNameTemplate = "cf{{.Random}}"
+
+	// MaxKeyspaceNameLength is the longest keyspace name accepted by Cassandra
+	MaxKeyspaceNameLength = 48
+)
+
+var invalidKeyspaceNameChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// KeyspaceNameData are values keyspace name templates are rendered with
+type KeyspaceNameData struct {
+	InstanceID       string
+	OrganizationGUID string
+	SpaceGUID        string
+	PlanName         string
+	Random           string
+}
+
+// KeyspaceName renders the template and sanitizes the result to a valid keyspace name,
+// names exceeding the length limit are truncated keeping the random suffix
+func KeyspaceName(nameTemplate string, data KeyspaceNameData) (string, error) {
+	tmpl, err := template.New("keyspace").Parse(nameTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var name bytes.Buffer
+	err = tmpl.Execute(&name, data)
+	if err != nil {
+		return "", err
+	}
+
+	return SanitizeKeyspaceName(name.String(), data.Random), nil
+}
+
+// SanitizeKeyspaceName lower cases the name, replaces characters other than
+// alphanumerics and underscores and makes sure it starts with a letter
+func SanitizeKeyspaceName(name, suffix string) string {
+	name = invalidKeyspaceNameChars.ReplaceAllString(strings.ToLower(name), "_")
+	name = strings.Trim(name, "_")
+
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		name = strings.TrimRight("cf_"+name, "_")
+	}
+
+	if len(name) > MaxKeyspaceNameLength {
+		suffix = strings.ToLower(suffix)
+		if suffix == "" || len(suffix) >= MaxKeyspaceNameLength/2 {
+			name = name[:MaxKeyspaceNameLength]
+		} else {
+			name = strings.TrimRight(name[:MaxKeyspaceNameLength-len(suffix)-1], "_") + "_" + suffix
+		}
+	}
+
+	return strings.TrimRight(name, "_")
+}
+
+// validateKeyspaceNameTemplate checks that the template renders with sample values
+// and that names of different instances differ, so it has to refer .Random or .InstanceID
+func validateKeyspaceNameTemplate(nameTemplate string) error {
+	data := KeyspaceNameData{
+		InstanceID:       "instance-id",
+		OrganizationGUID: "organization-guid",
+		SpaceGUID:        "space-guid",
+		PlanName:         "plan",
+		Random:           "0123456789abcdef0123",
+	}
+	name, err := KeyspaceName(nameTemplate, data)
+	if err != nil {
+		return fmt.Errorf("invalid keyspace_name_template: %s", err.Error())
+	}
+
+	data.InstanceID = "other-instance-id"
+	data.Random = "fedcba9876543210fedc"
+	other, err := KeyspaceName(nameTemplate, data)
+	if err != nil {
+		return fmt.Errorf("invalid keyspace_name_template: %s", err.Error())
+	}
+
+	if name == other {
+		return fmt.Errorf("invalid keyspace_name_template: it must refer .Random or .InstanceID")
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// PermissionAll grants every keyspace permission
+	PermissionAll = "ALL"
+
+	// FullPermissionProfile grants every keyspace permission,
+	// it is the only profile of plans not listing allowed profiles
+	FullPermissionProfile = "full"
+
+	// CustomPermissionProfile is recorded for bindings requesting a list of permissions
+	// not matching any of the profiles
+	CustomPermissionProfile = "custom"
+)
+
+// keyspacePermissions are permissions grantable on a keyspace
+var keyspacePermissions = []string{PermissionAll, "CREATE", "ALTER", "DROP", "SELECT", "MODIFY", "AUTHORIZE"}
+
+// permissionProfiles are named sets of keyspace permissions bindings are created with
+var permissionProfiles = map[string][]string{
+	FullPermissionProfile: {PermissionAll},
+	"readwrite":           {"MODIFY", "SELECT"},
+	"readonly":            {"SELECT"},
+}
+
+// ProfilePermissions returns sorted keyspace permissions of the profile
+func ProfilePermissions(profile string) ([]string, bool) {
+	permissions, ok := permissionProfiles[profile]
+	return permissions, ok
+}
+
+// NormalizePermissions upper cases, sorts and deduplicates keyspace permissions,
+// ALL supersedes any other permission
+func NormalizePermissions(permissions []string) ([]string, error) {
+	set := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		permission = strings.ToUpper(strings.TrimSpace(permission))
+		if !isKeyspacePermission(permission) {
+			return nil, fmt.Errorf("unknown permission %q", permission)
+		}
+		set[permission] = true
+	}
+
+	if set[PermissionAll] {
+		return []string{PermissionAll}, nil
+	}
+
+	normalized := make([]string, 0, len(set))
+	for permission := range set {
+		normalized = append(normalized, permission)
+	}
+	sort.Strings(normalized)
+
+	return normalized, nil
+}
+
+func isKeyspacePermission(permission string) bool {
+	for _, p := range keyspacePermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedPermissionProfiles returns permission profiles bindings of the plan may be created with,
+// the first one is used for bindings not requesting permissions
+func (p *PlanConfig) AllowedPermissionProfiles() []string {
+	if len(p.PermissionProfiles) == 0 {
+		return []string{FullPermissionProfile}
+	}
+	return p.PermissionProfiles
+}
+
+// validatePermissionProfiles checks that the plan lists known permission profiles only
+func (p *PlanConfig) validatePermissionProfiles() error {
+	for _, profile := range p.PermissionProfiles {
+		if _, ok := permissionProfiles[profile]; !ok {
+			return fmt.Errorf("unknown permission profile %q", profile)
+		}
+	}
+	return nil
+}
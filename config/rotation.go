@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// RotationInPlace changes password of the binding login,
+	// applications fail to connect until they are restaged
+	RotationInPlace = "in_place"
+
+	// RotationDual alternates two logins of the binding,
+	// the previous login keeps working during the grace period
+	RotationDual = "dual"
+
+	defaultGracePeriod = 24 * time.Hour
+)
+
+// RotationConfig describes how credentials of bindings are rotated
+type RotationConfig struct {
+	Mode        string        `yaml:"mode"`
+	GracePeriod time.Duration `yaml:"grace_period"`
+}
+
+var defaultRotationConfig = RotationConfig{
+	Mode:        RotationInPlace,
+	GracePeriod: defaultGracePeriod,
+}
+
+func (r *RotationConfig) Validate() error {
+	switch r.Mode {
+	case RotationInPlace, RotationDual:
+	default:
+		return fmt.Errorf("unsupported rotation mode %q", r.Mode)
+	}
+
+	if r.GracePeriod <= 0 {
+		return fmt.Errorf("invalid rotation grace_period %s", r.GracePeriod)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+)
+
+// PlanSchemasConfig describes JSON schemas of parameters accepted by the plan
+type PlanSchemasConfig struct {
+	ServiceInstance ServiceInstanceSchemasConfig `yaml:"service_instance" json:"service_instance"`
+}
+
+type ServiceInstanceSchemasConfig struct {
+	Create *InputParametersSchemaConfig `yaml:"create" json:"create,omitempty"`
+}
+
+type InputParametersSchemaConfig struct {
+	Parameters JSONSchema `yaml:"parameters" json:"parameters"`
+}
+
+// JSONSchema holds JSON schema in the form produced by encoding/json,
+// so it can be published in the catalog as is
+type JSONSchema map[string]interface{}
+
+func (s *JSONSchema) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw map[interface{}]interface{}
+
+	err := unmarshal(&raw)
+	if err != nil {
+		return err
+	}
+
+	converted, err := convertYAML(raw)
+	if err != nil {
+		return err
+	}
+
+	*s = converted.(map[string]interface{})
+	return nil
+}
+
+// convertYAML replaces maps with interface{} keys produced by yaml
+// with maps with string keys that encoding/json is able to marshal
+func convertYAML(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("schema key %v is not a string", k)
+			}
+
+			item, err := convertYAML(v)
+			if err != nil {
+				return nil, err
+			}
+			converted[key] = item
+		}
+		return converted, nil
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, v := range value {
+			item, err := convertYAML(v)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = item
+		}
+		return converted, nil
+	}
+	return value, nil
+}
+
+// CreateParametersSchema returns schema of service instance creation parameters
+// or nil if the plan does not define it
+func (p *PlanConfig) CreateParametersSchema() map[string]interface{} {
+	if p.Schemas == nil || p.Schemas.ServiceInstance.Create == nil {
+		return nil
+	}
+	return p.Schemas.ServiceInstance.Create.Parameters
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+const defaultTLSMinVersion = "1.2"
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig describes HTTPS listener of the broker, plain HTTP is served if cert_file is not set
+type TLSConfig struct {
+	CertFile     string   `yaml:"cert_file"`
+	KeyFile      string   `yaml:"key_file"`
+	MinVersion   string   `yaml:"min_version"`
+	CipherSuites []string `yaml:"cipher_suites"`
+
+	// ClientCAFile enables mutual TLS, clients must present certificates signed by the CA
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+var defaultTLSConfig = TLSConfig{
+	MinVersion: defaultTLSMinVersion,
+}
+
+func (t *TLSConfig) Enabled() bool {
+	return t.CertFile != ""
+}
+
+func (t *TLSConfig) Validate() error {
+	if !t.Enabled() {
+		if t.KeyFile != "" || t.ClientCAFile != "" {
+			return errors.New("tls cert_file is required")
+		}
+		return nil
+	}
+
+	if t.KeyFile == "" {
+		return errors.New("tls key_file is required")
+	}
+
+	if _, ok := tlsVersions[t.MinVersion]; !ok {
+		return fmt.Errorf("unsupported tls min_version %q", t.MinVersion)
+	}
+
+	_, err := cipherSuiteIDs(t.CipherSuites)
+	return err
+}
+
+// ServerTLSConfig loads certificates from disk and returns TLS config of the listener
+func (t *TLSConfig) ServerTLSConfig() (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls certificate: %s", err.Error())
+	}
+
+	cipherSuites, err := cipherSuiteIDs(t.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tlsVersions[t.MinVersion],
+		CipherSuites: cipherSuites,
+	}
+
+	if t.ClientCAFile != "" {
+		tlsConfig.ClientCAs, err = loadCertPool(t.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// cipherSuiteIDs resolves names of secure cipher suites, nil selects the Go defaults
+func cipherSuiteIDs(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported tls cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %s", err.Error())
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", path)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,170 @@
+package config_test
+
+import (
+	. "github.com/Altoros/cf-cassandra-broker/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// writeCertificate writes self-signed certificate and its key to the directory
+func writeCertificate(dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "broker"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	Ω(err).ShouldNot(HaveOccurred())
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	return certFile, keyFile
+}
+
+var _ = Describe("TLSConfig", func() {
+	var config *Config
+
+	BeforeEach(func() {
+		config = Default()
+	})
+
+	It("serves plain HTTP by default", func() {
+		Ω(config.TLS.Enabled()).To(BeFalse())
+		Ω(config.TLS.MinVersion).To(Equal("1.2"))
+	})
+
+	Describe("Initialize", func() {
+		It("sets tls config", func() {
+			var b = []byte(`
+tls:
+  cert_file: /etc/broker/cert.pem
+  key_file: /etc/broker/key.pem
+  min_version: "1.3"
+  client_ca_file: /etc/broker/ca.pem
+`)
+			err := config.Initialize(b)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.TLS.Enabled()).To(BeTrue())
+			Ω(config.TLS.CertFile).To(Equal("/etc/broker/cert.pem"))
+			Ω(config.TLS.KeyFile).To(Equal("/etc/broker/key.pem"))
+			Ω(config.TLS.MinVersion).To(Equal("1.3"))
+			Ω(config.TLS.ClientCAFile).To(Equal("/etc/broker/ca.pem"))
+		})
+
+		It("requires key file", func() {
+			var b = []byte(`
+tls:
+  cert_file: /etc/broker/cert.pem
+`)
+			Ω(config.Initialize(b)).Should(MatchError("tls key_file is required"))
+		})
+
+		It("requires cert file", func() {
+			var b = []byte(`
+tls:
+  client_ca_file: /etc/broker/ca.pem
+`)
+			Ω(config.Initialize(b)).Should(MatchError("tls cert_file is required"))
+		})
+
+		It("rejects unknown min version", func() {
+			var b = []byte(`
+tls:
+  cert_file: /etc/broker/cert.pem
+  key_file: /etc/broker/key.pem
+  min_version: "2.0"
+`)
+			Ω(config.Initialize(b)).Should(MatchError(`unsupported tls min_version "2.0"`))
+		})
+
+		It("rejects insecure cipher suites", func() {
+			var b = []byte(`
+tls:
+  cert_file: /etc/broker/cert.pem
+  key_file: /etc/broker/key.pem
+  cipher_suites:
+  - TLS_RSA_WITH_RC4_128_SHA
+`)
+			Ω(config.Initialize(b)).Should(MatchError(`unsupported tls cipher suite "TLS_RSA_WITH_RC4_128_SHA"`))
+		})
+	})
+
+	Describe("ServerTLSConfig", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "tls")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			config.TLS.CertFile, config.TLS.KeyFile = writeCertificate(dir)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("loads the certificate", func() {
+			config.TLS.CipherSuites = []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+
+			tlsConfig, err := config.TLS.ServerTLSConfig()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(tlsConfig.Certificates).To(HaveLen(1))
+			Ω(tlsConfig.MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+			Ω(tlsConfig.CipherSuites).To(Equal([]uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}))
+			Ω(tlsConfig.ClientAuth).To(Equal(tls.NoClientCert))
+		})
+
+		It("requires client certificates signed by the client CA", func() {
+			config.TLS.ClientCAFile = config.TLS.CertFile
+
+			tlsConfig, err := config.TLS.ServerTLSConfig()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(tlsConfig.ClientAuth).To(Equal(tls.RequireAndVerifyClientCert))
+			Ω(tlsConfig.ClientCAs).ShouldNot(BeNil())
+		})
+
+		It("fails if the certificate is missing", func() {
+			config.TLS.CertFile = filepath.Join(dir, "missing.pem")
+
+			_, err := config.TLS.ServerTLSConfig()
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("fails if the client CA has no certificates", func() {
+			config.TLS.ClientCAFile = config.TLS.KeyFile
+
+			_, err := config.TLS.ServerTLSConfig()
+			Ω(err).Should(MatchError("no certificates found in CA file " + config.TLS.KeyFile))
+		})
+	})
+})
@@ -2,6 +2,7 @@ package migrate
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/Altoros/cf-cassandra-broker/config"
 	"github.com/gocql/gocql"
@@ -15,7 +16,7 @@ func Run(config *config.CassandraConfig) error {
 		return fmt.Errorf("error connecting to cassandra: %s", err.Error())
 	}
 
-	err = createKeyspace(session, config.Keyspace)
+	err = createKeyspace(session, config.Keyspace, config.ReplicationFactor)
 	if err != nil {
 		return fmt.Errorf("error creating keyspace: %s", err.Error())
 	}
@@ -38,18 +39,25 @@ func Run(config *config.CassandraConfig) error {
 		return fmt.Errorf("error creating bindings: %s", err.Error())
 	}
 
+	err = createOperationsTable(session, config.Keyspace)
+	if err != nil {
+		return fmt.Errorf("error creating operations: %s", err.Error())
+	}
+
+	err = createAuditEventsTable(session, config.Keyspace)
+	if err != nil {
+		return fmt.Errorf("error creating audit_events: %s", err.Error())
+	}
+
 	return nil
 }
 
 func connectToCassandra(config *config.CassandraConfig, useKeyspace bool) (*gocql.Session, error) {
-	cluster := gocql.NewCluster(config.Nodes...)
-	if useKeyspace {
-		cluster.Keyspace = config.Keyspace
-	}
-	cluster.Consistency = gocql.Quorum
-	cluster.Authenticator = gocql.PasswordAuthenticator{
-		Username: config.Username,
-		Password: config.Password,
+	// migrations only change schema, so every query uses the DDL consistency
+	cluster := config.NewCluster()
+	cluster.Consistency = gocql.ParseConsistency(config.Consistency.DDL)
+	if !useKeyspace {
+		cluster.Keyspace = ""
 	}
 
 	session, err := cluster.CreateSession()
@@ -60,11 +68,11 @@ func connectToCassandra(config *config.CassandraConfig, useKeyspace bool) (*gocq
 	return session, nil
 }
 
-func createKeyspace(session *gocql.Session, keyspace string) error {
+func createKeyspace(session *gocql.Session, keyspace string, replicationFactor int) error {
 	query := fmt.Sprintf(`
 CREATE KEYSPACE IF NOT EXISTS %s
-WITH replication = { 'class' : 'SimpleStrategy', 'replication_factor' : 3 }`, keyspace)
-	err := session.Query(query).Consistency(gocql.Quorum).Exec()
+WITH replication = { 'class' : 'SimpleStrategy', 'replication_factor' : %d }`, keyspace, replicationFactor)
+	err := session.Query(query).Exec()
 	if err != nil {
 		return err
 	}
@@ -76,6 +84,16 @@ func createInstancesTable(session *gocql.Session, keyspace string) error {
 CREATE TABLE IF NOT EXISTS instances (
 	id text PRIMARY KEY,
 	keyspace_name text,
+	role_name text,
+	permission_roles set<text>,
+	service_id text,
+	plan_id text,
+	organization_guid text,
+	space_guid text,
+	platform text,
+	context text,
+	parameters text,
+	state text,
 	created_at timestamp
 )`
 
@@ -83,6 +101,19 @@ CREATE TABLE IF NOT EXISTS instances (
 	if err != nil {
 		return fmt.Errorf("failed to create table: %s", err.Error())
 	}
+
+	for _, column := range []string{"role_name", "service_id", "plan_id", "organization_guid", "space_guid", "platform",
+		"context", "parameters", "state"} {
+		err = addColumnIfNotExist(session, "instances", column, "text")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = addColumnIfNotExist(session, "instances", "permission_roles", "set<text>")
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -91,15 +122,118 @@ func createBindingsTable(session *gocql.Session, keyspace string) error {
 CREATE TABLE IF NOT EXISTS bindings (
 	id text PRIMARY KEY,
 	instance_id text,
+	service_id text,
+	plan_id text,
 	app_guid text,
+	route text,
+	context text,
+	parameters text,
+	permission_profile text,
+	permissions text,
+	table_permissions text,
 	username text,
 	password text,
-	created_at timestamp
+	previous_username text,
+	previous_expires_at timestamp,
+	state text,
+	created_at timestamp,
+	rotated_at timestamp,
+	expires_at timestamp
 )`
-	err := session.Query(createTableQuery).Consistency(gocql.All).Exec()
+	err := session.Query(createTableQuery).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to create table: %s", err.Error())
+	}
+
+	columns := []string{"service_id", "plan_id", "route", "context", "parameters", "permission_profile", "permissions",
+		"table_permissions", "previous_username", "state"}
+	for _, column := range columns {
+		err = addColumnIfNotExist(session, "bindings", column, "text")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, column := range []string{"previous_expires_at", "rotated_at", "expires_at"} {
+		err = addColumnIfNotExist(session, "bindings", column, "timestamp")
+		if err != nil {
+			return err
+		}
+	}
+
+	// bindings of an instance are listed and rotated without scanning the whole table
+	err = session.Query("CREATE INDEX IF NOT EXISTS bindings_instance_id ON bindings (instance_id)").Exec()
+	if err != nil {
+		return fmt.Errorf("failed to create index: %s", err.Error())
+	}
+
+	return nil
+}
+
+func createOperationsTable(session *gocql.Session, keyspace string) error {
+	createTableQuery := `
+CREATE TABLE IF NOT EXISTS operations (
+	instance_id text,
+	id timeuuid,
+	type text,
+	state text,
+	description text,
+	created_at timestamp,
+	updated_at timestamp,
+	PRIMARY KEY (instance_id, id)
+) WITH CLUSTERING ORDER BY (id DESC)`
+	err := session.Query(createTableQuery).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to create table: %s", err.Error())
+	}
+
+	return nil
+}
+
+func createAuditEventsTable(session *gocql.Session, keyspace string) error {
+	createTableQuery := `
+CREATE TABLE IF NOT EXISTS audit_events (
+	binding_id text,
+	id timeuuid,
+	instance_id text,
+	action text,
+	actor text,
+	result text,
+	details text,
+	created_at timestamp,
+	PRIMARY KEY (binding_id, id)
+) WITH CLUSTERING ORDER BY (id DESC)`
+	err := session.Query(createTableQuery).Exec()
 	if err != nil {
 		return fmt.Errorf("failed to create table: %s", err.Error())
 	}
 
 	return nil
 }
+
+// addColumnIfNotExist adds column to the table created by previous version of the broker,
+// Cassandra has no ALTER TABLE ADD IF NOT EXISTS, so the error about existing column is ignored
+func addColumnIfNotExist(session *gocql.Session, table, column, columnType string) error {
+	query := fmt.Sprintf("ALTER TABLE %s ADD %s %s", table, column, columnType)
+	err := session.Query(query).Exec()
+	if err != nil && !isColumnExistError(err) {
+		return fmt.Errorf("failed to add column %s.%s: %s", table, column, err.Error())
+	}
+
+	return nil
+}
+
+// errInvalid is the code of invalid request errors of the native protocol
+const errInvalid = 0x2200
+
+// isColumnExistError reports whether ALTER TABLE ADD failed because the column exists,
+// the message differs between Cassandra versions
+func isColumnExistError(err error) bool {
+	requestErr, ok := err.(gocql.RequestError)
+	if !ok || requestErr.Code() != errInvalid {
+		return false
+	}
+
+	message := strings.ToLower(requestErr.Message())
+	return strings.Contains(message, "conflicts with an existing column") || strings.Contains(message, "already exists")
+}
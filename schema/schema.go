@@ -0,0 +1,304 @@
+// Package schema validates service parameters against a subset of JSON Schema draft-04.
+//
+// Supported keywords: type, enum, properties, required, additionalProperties,
+// minimum, maximum, minLength, maxLength, pattern, items, minItems and maxItems.
+package schema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// Validate checks value decoded by encoding/json against the schema
+// and returns all violations found
+func Validate(schema map[string]interface{}, value interface{}) []ValidationError {
+	v := &validator{}
+	v.validate("", schema, value)
+	return v.errors
+}
+
+var supportedKeywords = map[string]bool{
+	"type": true, "enum": true, "properties": true, "required": true, "additionalProperties": true,
+	"minimum": true, "maximum": true, "minLength": true, "maxLength": true, "pattern": true,
+	"items": true, "minItems": true, "maxItems": true,
+}
+
+// annotations don't affect validation, so they are allowed along with the supported keywords
+var annotations = map[string]bool{"$schema": true, "id": true, "title": true, "description": true, "default": true}
+
+// Check reports keywords of the schema which are not enforced by Validate,
+// so schemas published as is are not mistaken for enforced ones
+func Check(schema map[string]interface{}) error {
+	return check("", schema)
+}
+
+func check(path string, schema map[string]interface{}) error {
+	keywords := make([]string, 0, len(schema))
+	for keyword := range schema {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+
+	for _, keyword := range keywords {
+		if annotations[keyword] {
+			continue
+		}
+		if !supportedKeywords[keyword] {
+			return fmt.Errorf("unsupported keyword %q", join(path, keyword))
+		}
+
+		switch value := schema[keyword].(type) {
+		case map[string]interface{}:
+			if keyword == "properties" {
+				names := make([]string, 0, len(value))
+				for name := range value {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				for _, name := range names {
+					property, ok := value[name].(map[string]interface{})
+					if !ok {
+						return fmt.Errorf("%s is not a schema", join(path, "properties."+name))
+					}
+					err := check(join(path, "properties."+name), property)
+					if err != nil {
+						return err
+					}
+				}
+			} else if keyword == "additionalProperties" || keyword == "items" {
+				err := check(join(path, keyword), value)
+				if err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			if keyword == "items" {
+				return fmt.Errorf("unsupported keyword %q, items must be a single schema", join(path, keyword))
+			}
+		case string:
+			if keyword == "pattern" {
+				if _, err := regexp.Compile(value); err != nil {
+					return fmt.Errorf("invalid pattern %q of %s", value, join(path, keyword))
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+type validator struct {
+	errors []ValidationError
+}
+
+func (v *validator) fail(field, format string, args ...interface{}) {
+	v.errors = append(v.errors, ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validate(field string, schema map[string]interface{}, value interface{}) {
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		v.fail(field, "must be of type %s", typeNames(t))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && !contains(enum, value) {
+		v.fail(field, "must be one of %v", enum)
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(field, schema, value)
+	case []interface{}:
+		v.validateArray(field, schema, value)
+	case string:
+		v.validateString(field, schema, value)
+	case float64:
+		v.validateNumber(field, schema, value)
+	}
+}
+
+func (v *validator) validateObject(field string, schema map[string]interface{}, object map[string]interface{}) {
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, ok := object[name]; !ok {
+					v.fail(join(field, name), "is required")
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if property, ok := properties[name].(map[string]interface{}); ok {
+			v.validate(join(field, name), property, object[name])
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(join(field, name), "is not allowed")
+			}
+		case map[string]interface{}:
+			v.validate(join(field, name), additional, object[name])
+		}
+	}
+}
+
+func (v *validator) validateArray(field string, schema map[string]interface{}, array []interface{}) {
+	if min, ok := number(schema["minItems"]); ok && float64(len(array)) < min {
+		v.fail(field, "must have at least %v items", min)
+	}
+	if max, ok := number(schema["maxItems"]); ok && float64(len(array)) > max {
+		v.fail(field, "must have at most %v items", max)
+	}
+
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range array {
+			v.validate(fmt.Sprintf("%s[%d]", field, i), items, item)
+		}
+	}
+}
+
+func (v *validator) validateString(field string, schema map[string]interface{}, s string) {
+	length := float64(len([]rune(s)))
+	if min, ok := number(schema["minLength"]); ok && length < min {
+		v.fail(field, "must be at least %v characters long", min)
+	}
+	if max, ok := number(schema["maxLength"]); ok && length > max {
+		v.fail(field, "must be at most %v characters long", max)
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.fail(field, "schema has invalid pattern %q", pattern)
+		} else if !re.MatchString(s) {
+			v.fail(field, "must match pattern %q", pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(field string, schema map[string]interface{}, n float64) {
+	if min, ok := number(schema["minimum"]); ok && n < min {
+		v.fail(field, "must be greater than or equal to %v", min)
+	}
+	if max, ok := number(schema["maximum"]); ok && n > max {
+		v.fail(field, "must be less than or equal to %v", max)
+	}
+}
+
+func matchesType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return matchesTypeName(t, value)
+	case []interface{}:
+		for _, name := range t {
+			if name, ok := name.(string); ok && matchesTypeName(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(name string, value interface{}) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+func typeNames(t interface{}) string {
+	if names, ok := t.([]interface{}); ok {
+		s := make([]string, len(names))
+		for i, name := range names {
+			s[i] = fmt.Sprint(name)
+		}
+		return strings.Join(s, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func contains(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if n, ok := number(v); ok {
+			if m, ok := value.(float64); ok && n == m {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// number converts numeric schema keyword values, which may come from YAML
+// as integers, to float64 used by encoding/json
+func number(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
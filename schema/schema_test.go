@@ -0,0 +1,112 @@
+package schema_test
+
+import (
+	"github.com/Altoros/cf-cassandra-broker/schema"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"encoding/json"
+)
+
+var _ = Describe("schema", func() {
+	var parametersSchema map[string]interface{}
+
+	validate := func(parameters string) []schema.ValidationError {
+		var value interface{}
+		Ω(json.Unmarshal([]byte(parameters), &value)).Should(Succeed())
+		return schema.Validate(parametersSchema, value)
+	}
+
+	BeforeEach(func() {
+		parametersSchema = map[string]interface{}{
+			"type":     "object",
+			"required": []interface{}{"replication_factor"},
+			"properties": map[string]interface{}{
+				"replication_factor": map[string]interface{}{
+					"type":    "integer",
+					"minimum": 1,
+					"maximum": 5,
+				},
+				"datacenters": map[string]interface{}{
+					"type":                 "object",
+					"additionalProperties": map[string]interface{}{"type": "integer"},
+				},
+				"tier": map[string]interface{}{
+					"enum": []interface{}{"gold", "silver"},
+				},
+			},
+			"additionalProperties": false,
+		}
+	})
+
+	Describe(".Validate", func() {
+		It("accepts valid parameters", func() {
+			Ω(validate(`{"replication_factor": 2, "datacenters": {"dc1": 3}, "tier": "gold"}`)).To(BeEmpty())
+		})
+
+		It("reports missing required properties", func() {
+			Ω(validate(`{}`)).To(ConsistOf(schema.ValidationError{Field: "replication_factor", Message: "is required"}))
+		})
+
+		It("reports type mismatches", func() {
+			Ω(validate(`{"replication_factor": 1.5}`)).To(ConsistOf(
+				schema.ValidationError{Field: "replication_factor", Message: "must be of type integer"},
+			))
+		})
+
+		It("reports out of range numbers", func() {
+			Ω(validate(`{"replication_factor": 7}`)).To(ConsistOf(
+				schema.ValidationError{Field: "replication_factor", Message: "must be less than or equal to 5"},
+			))
+		})
+
+		It("validates additional properties against the schema", func() {
+			Ω(validate(`{"replication_factor": 1, "datacenters": {"dc1": "three"}}`)).To(ConsistOf(
+				schema.ValidationError{Field: "datacenters.dc1", Message: "must be of type integer"},
+			))
+		})
+
+		It("rejects unknown properties", func() {
+			Ω(validate(`{"replication_factor": 1, "foo": "bar"}`)).To(ConsistOf(
+				schema.ValidationError{Field: "foo", Message: "is not allowed"},
+			))
+		})
+
+		It("reports values out of enum", func() {
+			Ω(validate(`{"replication_factor": 1, "tier": {"name": "bronze"}}`)).To(HaveLen(1))
+		})
+	})
+
+	Describe("Check", func() {
+		It("accepts supported keywords and annotations", func() {
+			parametersSchema["$schema"] = "http://json-schema.org/draft-04/schema#"
+			parametersSchema["description"] = "keyspace settings"
+			Ω(schema.Check(parametersSchema)).Should(Succeed())
+		})
+
+		It("rejects unsupported keywords", func() {
+			parametersSchema["oneOf"] = []interface{}{}
+			Ω(schema.Check(parametersSchema)).Should(MatchError(`unsupported keyword "oneOf"`))
+		})
+
+		It("rejects unsupported keywords of nested schemas", func() {
+			datacenters := parametersSchema["properties"].(map[string]interface{})["datacenters"].(map[string]interface{})
+			datacenters["additionalProperties"] = map[string]interface{}{"type": "integer", "exclusiveMinimum": true}
+			Ω(schema.Check(parametersSchema)).Should(MatchError(
+				`unsupported keyword "properties.datacenters.additionalProperties.exclusiveMinimum"`))
+		})
+
+		It("rejects invalid patterns", func() {
+			parametersSchema["properties"].(map[string]interface{})["tier"] = map[string]interface{}{"pattern": "("}
+			Ω(schema.Check(parametersSchema)).Should(HaveOccurred())
+		})
+	})
+
+	Describe("ValidationError", func() {
+		It("prefixes message with the field", func() {
+			err := schema.ValidationError{Field: "replication_factor", Message: "is required"}
+			Ω(err.Error()).To(Equal("replication_factor: is required"))
+		})
+	})
+})